@@ -33,6 +33,7 @@ export class Client {
 				throw new Error("TRACE not implemented");
 			case HTTPMethod.GET:
 				req.params = message;
+				req.paramsSerializer = SerialiseParams;
 				break;
 			default:
 				req.data = message;
@@ -92,6 +93,29 @@ export class Client {
 	}
 }
 
+/** SerialiseParams encodes a protojson message as query params, using dotted keys for nested messages and repeating keys for repeated fields */
+export function SerialiseParams(params: any): string {
+	let parts: string[] = [];
+	let add = (key: string, value: any) => {
+		if (value === null || value === undefined) {
+			return;
+		}
+		if (Array.isArray(value)) {
+			for (let item of value) {
+				add(key, item);
+			}
+		} else if (typeof value === "object") {
+			for (let name of Object.keys(value)) {
+				add(key === "" ? name : `${key}.${name}`, value[name]);
+			}
+		} else {
+			parts.push(`${encodeURIComponent(key)}=${encodeURIComponent(String(value))}`);
+		}
+	}
+	add("", params);
+	return parts.join("&");
+}
+
 export enum HTTPMethod {
 	GET = "GET",
 	HEAD = "HEAD",
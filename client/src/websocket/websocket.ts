@@ -3,6 +3,8 @@ import { IMutex, Mutex } from "../common";
 import * as uuid from "uuid";
 
 export const EOFMessage = "EOF";
+/** Sent by the server when it begins shutting down, the stream remains usable but should be re-established elsewhere when convenient */
+export const GoingAwayMessage = "GOING_AWAY";
 
 /** A logger that wraps the standard console log functions */
 export interface Logger {
@@ -51,6 +53,8 @@ export class MercuryWebSocket<ReqT extends ProtoJSONCompatible, ResT = any> {
 	public readonly url: string;
 	/** The function this websocket uses to parse response data into the desired response message class */
 	public readonly parser: Parser<ResT>;
+	/** Whether the server has announced that it is shutting down */
+	public goingAway: boolean = false;
 	/** Whether or not this class has been properly set up by its init() function */
 	private initialised: boolean = false;
 	/** Rejects if sending is not yet ready or has been closed after opening */
@@ -304,6 +308,9 @@ export class MercuryWebSocket<ReqT extends ProtoJSONCompatible, ResT = any> {
 		if (typeof ev.data === "string" && ev.data === EOFMessage) {
 			this.responseBuffer.push(new EOFError());
 			this.recvOpen = Promise.resolve(new EOFError());
+		} else if (typeof ev.data === "string" && ev.data === GoingAwayMessage) {
+			this.goingAway = true;
+			this.logger.warn(`${this.nameTag(uuid.v4())}server is going away`);
 		} else {
 			try {
 				let parsed = await this.parser(ev.data);
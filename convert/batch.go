@@ -0,0 +1,234 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ReasonInvalidBatch is the ErrorInfo reason given when a batch request can't be parsed or has too many calls
+const ReasonInvalidBatch = "INVALID_BATCH"
+
+// BatchConfig configures the batch endpoint
+type BatchConfig struct {
+	// MaxCalls is the most calls a single batch may contain, defaults to 50
+	MaxCalls int
+	// MaxConcurrency is the most calls from a single batch run at once, defaults to 8
+	MaxConcurrency int
+	// MaxSize is the largest batch body accepted, defaults to 1MiB
+	MaxSize int64
+}
+
+// BatchCall is a single unary call within a batch request
+type BatchCall struct {
+	// Procedure is the procedure to call
+	Procedure string `json:"procedure"`
+	// Method is the HTTP method to call the procedure with, defaults to POST if there is a body and GET otherwise
+	Method string `json:"method,omitempty"`
+	// Params are the query params of the call, each may be a string or an array of strings
+	Params BatchParams `json:"params,omitempty"`
+	// Body is the JSON request body of the call
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchParams are query params which accept either a single string or an array of strings for each key
+type BatchParams map[string][]string
+
+// UnmarshalJSON accepts both {"key":"value"} and {"key":["value1","value2"]}
+func (b *BatchParams) UnmarshalJSON(data []byte) error {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	params := BatchParams{}
+	for key, value := range raw {
+		var single string
+		if err := json.Unmarshal(value, &single); err == nil {
+			params[key] = []string{single}
+			continue
+		}
+		var multiple []string
+		if err := json.Unmarshal(value, &multiple); err != nil {
+			return fmt.Errorf("param %s must be a string or an array of strings", key)
+		}
+		params[key] = multiple
+	}
+	*b = params
+	return nil
+}
+
+// BatchResult is the response to a single call within a batch request
+type BatchResult struct {
+	// Status is the HTTP status code of the call
+	Status int `json:"status"`
+	// Headers are the response headers of the call
+	Headers http.Header `json:"headers,omitempty"`
+	// Body is the response body of the call, error messages which aren't JSON are given as a JSON string
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// SetBatchConfig configures the limits of the batch endpoint
+func (p *Proxy) SetBatchConfig(config BatchConfig) {
+	p.batch = config
+}
+
+func (p *Proxy) getBatchConfig() BatchConfig {
+	config := defaultProxy.batch
+	if p != nil {
+		config = p.batch
+	}
+	if config.MaxCalls <= 0 {
+		config.MaxCalls = 50
+	}
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = 8
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = 1 << 20
+	}
+	return config
+}
+
+// ProxyBatch serves a batch request, see Proxy.ProxyBatch
+func ProxyBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, conn grpc.ClientConnInterface, txid string, loggers ...logs.Writer) {
+	defaultProxy.ProxyBatch(ctx, w, r, conn, txid, loggers...)
+}
+
+// ProxyBatch serves a POST request whose body is a JSON array of BatchCall, responding with a JSON array of BatchResult in the same order.
+// Each call is proxied through conn concurrently, exactly as ProxyRequest would proxy it, and carries the headers of the batch request such as Authorization and cookies
+func (p *Proxy) ProxyBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, conn grpc.ClientConnInterface, txid string, loggers ...logs.Writer) {
+	ctx, _, end, ok := p.beginRequest(ctx, w, txid)
+	if !ok {
+		return
+	}
+	defer end()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeStatusError(w, http.StatusMethodNotAllowed, codes.Unimplemented, ReasonInvalidBatch, "mercury: batch requests must use POST", 0)
+		return
+	}
+	config := p.getBatchConfig()
+	calls := []BatchCall{}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, config.MaxSize))
+	if err != nil && int64(len(body)) == config.MaxSize {
+		// MaxBytesReader stops at exactly the limit, and also tells the server to close the connection as the rest of the body is unread
+		writeStatusError(w, http.StatusRequestEntityTooLarge, codes.ResourceExhausted, ReasonBodyTooLarge, fmt.Sprintf("mercury: batch body is larger than %d bytes", config.MaxSize), 0)
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &calls)
+	}
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, codes.InvalidArgument, ReasonInvalidBatch, fmt.Sprintf("mercury: batch body must be a JSON array of calls: %v", err), 0)
+		return
+	}
+	if len(calls) > config.MaxCalls {
+		writeStatusError(w, http.StatusBadRequest, codes.InvalidArgument, ReasonInvalidBatch, fmt.Sprintf("mercury: batch has %d calls, the limit is %d", len(calls), config.MaxCalls), 0)
+		return
+	}
+	results := make([]BatchResult, len(calls))
+	slots := make(chan struct{}, config.MaxConcurrency)
+	wg := sync.WaitGroup{}
+	for i, call := range calls {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, call BatchCall) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = p.batchCall(ctx, r, call, conn, txid, loggers)
+		}(i, call)
+	}
+	wg.Wait()
+	out, err := json.Marshal(results)
+	if err != nil {
+		writeStatusError(w, http.StatusInternalServerError, codes.Internal, ReasonInvalidBatch, fmt.Sprintf("mercury: failed to marshal batch results: %v", err), 0)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// batchCall proxies a single call from a batch as its own HTTP request
+func (p *Proxy) batchCall(ctx context.Context, r *http.Request, call BatchCall, conn grpc.ClientConnInterface, txid string, loggers []logs.Writer) (result BatchResult) {
+	capture := newResponseCapture()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			for _, logger := range loggers {
+				logger.LogErrorf(txid, "mercury: caught panic proxying batch call to %s: %v", call.Procedure, recovered)
+			}
+			capture = newResponseCapture()
+			writeStatusError(capture, http.StatusInternalServerError, codes.Internal, ReasonInvalidBatch, "mercury: batch call failed", 0)
+			result = capture.result()
+		}
+	}()
+	sub, err := newBatchRequest(ctx, r, call)
+	if err != nil {
+		writeStatusError(capture, http.StatusBadRequest, codes.InvalidArgument, ReasonInvalidBatch, fmt.Sprintf("mercury: %v", err), 0)
+		return capture.result()
+	}
+	p.count("mercury_batch_calls", map[string]string{"procedure": call.Procedure})
+	p.proxyUnary(ctx, capture, sub, call.Procedure, conn, txid, loggers)
+	return capture.result()
+}
+
+// newBatchRequest builds the HTTP request for a call from a batch, copying the batch request's headers apart from those describing its own body, conditions or idempotency
+func newBatchRequest(ctx context.Context, r *http.Request, call BatchCall) (*http.Request, error) {
+	if call.Procedure == "" {
+		return nil, fmt.Errorf("batch call has no procedure")
+	}
+	method := strings.ToUpper(call.Method)
+	if method == "" {
+		method = http.MethodGet
+		if len(call.Body) > 0 {
+			method = http.MethodPost
+		}
+	}
+	if MethodFromString(method) == httpapi.Method_UNKNOWN {
+		return nil, fmt.Errorf("batch call to %s has invalid method %q", call.Procedure, call.Method)
+	}
+	target := &url.URL{Path: "/" + call.Procedure, RawQuery: url.Values(call.Params).Encode()}
+	sub, err := http.NewRequest(method, target.String(), bytes.NewReader(call.Body))
+	if err != nil {
+		return nil, err
+	}
+	sub = sub.WithContext(ctx)
+	sub.Header = cloneHeader(r.Header)
+	for _, name := range []string{"Content-Length", "Content-Type", "Idempotency-Key", "If-Match", "If-None-Match", "Upgrade"} {
+		sub.Header.Del(name)
+	}
+	if len(call.Body) > 0 {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	sub.Host = r.Host
+	sub.RemoteAddr = r.RemoteAddr
+	return sub, nil
+}
+
+// result converts the captured response to a BatchResult
+func (c *responseCapture) result() BatchResult {
+	res := c.response()
+	result := BatchResult{
+		Status:  res.statusCode,
+		Headers: res.header,
+	}
+	if len(res.body) > 0 {
+		if json.Valid(res.body) {
+			result.Body = res.body
+		} else {
+			result.Body, _ = json.Marshal(string(res.body))
+		}
+	}
+	return result
+}
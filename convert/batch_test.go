@@ -0,0 +1,119 @@
+package convert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeConn answers ProxyUnary calls with respond, recording the requests it receives
+type fakeConn struct {
+	mu       sync.Mutex
+	requests []*httpapi.Request
+	respond  func(req *httpapi.Request) (*httpapi.Response, error)
+}
+
+func (f *fakeConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	req := args.(*httpapi.Request)
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	res, err := f.respond(req)
+	if err != nil {
+		return err
+	}
+	*reply.(*httpapi.Response) = httpapi.Response{StatusCode: res.StatusCode, Payload: res.Payload, WriteHeaders: res.WriteHeaders}
+	return nil
+}
+
+func (f *fakeConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "streams not supported")
+}
+
+func TestProxy_ProxyBatch(t *testing.T) {
+	conn := &fakeConn{respond: func(req *httpapi.Request) (*httpapi.Response, error) {
+		switch req.GetProcedure() {
+		case "Random":
+			return &httpapi.Response{StatusCode: http.StatusOK, Payload: []byte(`{"number":"` + strings.Join(req.GetParams()["upperBound"].GetValues(), ",") + `"}`)}, nil
+		case "UploadPhoto":
+			return &httpapi.Response{StatusCode: http.StatusOK, Payload: req.GetPayload()}, nil
+		}
+		return nil, status.Error(codes.Unimplemented, "no such procedure")
+	}}
+	p := NewProxy()
+	p.SetBatchConfig(BatchConfig{MaxCalls: 3, MaxConcurrency: 2})
+	newRequest := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer token")
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	t.Run("calls in order", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p.ProxyBatch(context.Background(), w, newRequest(`[
+			{"procedure":"Random","params":{"upperBound":["10","20"]}},
+			{"procedure":"UploadPhoto","body":{"data":"aGk="}},
+			{"procedure":"Missing","method":"DELETE"}
+		]`), conn, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		results := []BatchResult{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, http.StatusOK, results[0].Status)
+			assert.JSONEq(t, `{"number":"10,20"}`, string(results[0].Body))
+			assert.Equal(t, http.StatusOK, results[1].Status)
+			assert.JSONEq(t, `{"data":"aGk="}`, string(results[1].Body))
+			assert.Equal(t, http.StatusNotImplemented, results[2].Status)
+			assert.JSONEq(t, `"no such procedure"`, string(results[2].Body))
+		}
+		for _, req := range conn.requests {
+			assert.Equal(t, []string{"Bearer token"}, req.GetHeaders()["Authorization"].GetValues())
+		}
+	})
+	t.Run("too many calls", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p.ProxyBatch(context.Background(), w, newRequest(`[{"procedure":"a"},{"procedure":"b"},{"procedure":"c"},{"procedure":"d"}]`), conn, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonInvalidBatch)
+	})
+	t.Run("too large", func(t *testing.T) {
+		p := NewProxy()
+		p.SetBatchConfig(BatchConfig{MaxSize: 32})
+		w := httptest.NewRecorder()
+		p.ProxyBatch(context.Background(), w, newRequest(`[{"procedure":"Random","params":{"upperBound":"10"}}]`), conn, "")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonBodyTooLarge)
+	})
+	t.Run("default limits", func(t *testing.T) {
+		config := NewProxy().getBatchConfig()
+		assert.Equal(t, 50, config.MaxCalls)
+		assert.Equal(t, int64(1<<20), config.MaxSize)
+	})
+	t.Run("invalid body", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p.ProxyBatch(context.Background(), w, newRequest(`{"procedure":"a"}`), conn, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("invalid call", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p.ProxyBatch(context.Background(), w, newRequest(`[{"procedure":"Random","method":"FETCH"}]`), conn, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":400`)
+	})
+	t.Run("not POST", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p.ProxyBatch(context.Background(), w, httptest.NewRequest(http.MethodGet, "/batch", nil), conn, "")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+	})
+}
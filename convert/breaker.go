@@ -0,0 +1,231 @@
+package convert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails all requests immediately
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of probe requests through to test whether the backend has recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures the circuit breakers created for each backend
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures which trips a closed breaker, defaults to 5
+	FailureThreshold int
+	// OpenTimeout is how long a breaker stays open before letting probe requests through, defaults to 30 seconds
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of concurrent probe requests allowed while half-open, defaults to 1
+	HalfOpenMaxRequests int
+	// SuccessThreshold is the number of consecutive successful probes required to close a half-open breaker, defaults to 1
+	SuccessThreshold int
+	// IsFailure decides whether an error returned by the backend counts towards tripping the breaker, defaults to IsBackendFailure
+	IsFailure func(err error) bool
+}
+
+// BackendKeyFunc identifies the backend a request is sent to, e.g. for choosing which circuit breaker protects it
+type BackendKeyFunc func(procedure string, conn grpc.ClientConnInterface) string
+
+// DefaultBackendKey identifies backends by the target of the connection where possible, otherwise by the connection itself
+func DefaultBackendKey(procedure string, conn grpc.ClientConnInterface) string {
+	if targeted, ok := conn.(interface{ Target() string }); ok {
+		return targeted.Target()
+	}
+	return fmt.Sprintf("%p", conn)
+}
+
+// IsBackendFailure returns true for errors indicating the backend could not be reached or did not respond in time.
+// Unknown isn't included, as plain errors returned by handlers become Unknown, so bad requests and application bugs would take a healthy backend offline
+func IsBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStatus, ok := status.FromError(err)
+	if !ok {
+		// Connections only return errors without a status when the call couldn't be made at all
+		return true
+	}
+	switch errStatus.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// breakerTransition records a change of state so it can be reported outside the breaker's lock
+type breakerTransition struct {
+	from, to BreakerState
+}
+
+func (t breakerTransition) changed() bool {
+	return t.from != t.to
+}
+
+type breaker struct {
+	mu               sync.Mutex
+	config           BreakerConfig
+	state            BreakerState
+	failures         int
+	successes        int
+	halfOpenInFlight int
+	openedAt         time.Time
+	now              func() time.Time
+}
+
+func newBreaker(config BreakerConfig) *breaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenMaxRequests <= 0 {
+		config.HalfOpenMaxRequests = 1
+	}
+	if config.SuccessThreshold <= 0 {
+		config.SuccessThreshold = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = IsBackendFailure
+	}
+	return &breaker{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// allow decides whether a request may proceed, returning how long the caller should wait before retrying if it may not
+func (b *breaker) allow() (allowed bool, retryAfter time.Duration, transition breakerTransition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	transition.from = b.state
+	if b.state == BreakerOpen {
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.config.OpenTimeout {
+			transition.to = b.state
+			return false, b.config.OpenTimeout - elapsed, transition
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	transition.to = b.state
+	if b.state == BreakerHalfOpen {
+		if b.halfOpenInFlight >= b.config.HalfOpenMaxRequests {
+			return false, time.Second, transition
+		}
+		b.halfOpenInFlight++
+	}
+	return true, 0, transition
+}
+
+// record updates the breaker with the result of a request previously permitted by allow
+func (b *breaker) record(err error) (transition breakerTransition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	transition.from = b.state
+	failed := b.config.IsFailure(err)
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			break
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight > 0 {
+			b.halfOpenInFlight--
+		}
+		if failed {
+			b.setState(BreakerOpen)
+			break
+		}
+		b.successes++
+		if b.successes >= b.config.SuccessThreshold {
+			b.setState(BreakerClosed)
+		}
+	case BreakerOpen:
+		// A request which started before the breaker opened, nothing more to learn from it
+	}
+	transition.to = b.state
+	return
+}
+
+// abandon releases a request previously permitted by allow without learning anything from it, e.g. because the client went away before it reached the backend
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.halfOpenInFlight > 0 {
+		b.halfOpenInFlight--
+	}
+}
+
+func (b *breaker) getState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState must be called with the lock held
+func (b *breaker) setState(state BreakerState) {
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	b.halfOpenInFlight = 0
+	if state == BreakerOpen {
+		b.openedAt = b.now()
+	}
+}
+
+// breakerSet lazily creates one breaker per backend
+type breakerSet struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	breakers map[string]*breaker
+}
+
+func newBreakerSet(config BreakerConfig) *breakerSet {
+	return &breakerSet{
+		config:   config,
+		breakers: map[string]*breaker{},
+	}
+}
+
+func (s *breakerSet) get(key string) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, exists := s.breakers[key]
+	if !exists {
+		b = newBreaker(s.config)
+		s.breakers[key] = b
+	}
+	return b
+}
@@ -0,0 +1,139 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      10 * time.Second,
+		SuccessThreshold: 1,
+	})
+	b.now = func() time.Time { return now }
+	unavailable := status.Error(codes.Unavailable, "down")
+	t.Run("closed allows requests", func(t *testing.T) {
+		allowed, _, transition := b.allow()
+		assert.True(t, allowed)
+		assert.False(t, transition.changed())
+		assert.False(t, b.record(unavailable).changed())
+	})
+	t.Run("non-failure errors reset the count", func(t *testing.T) {
+		b.allow()
+		assert.False(t, b.record(status.Error(codes.NotFound, "missing")).changed())
+		b.allow()
+		assert.False(t, b.record(unavailable).changed())
+		assert.Equal(t, BreakerClosed, b.getState())
+	})
+	t.Run("threshold trips breaker", func(t *testing.T) {
+		b.allow()
+		transition := b.record(unavailable)
+		assert.Equal(t, breakerTransition{from: BreakerClosed, to: BreakerOpen}, transition)
+	})
+	t.Run("open fails fast", func(t *testing.T) {
+		now = now.Add(4 * time.Second)
+		allowed, retryAfter, _ := b.allow()
+		assert.False(t, allowed)
+		assert.Equal(t, 6*time.Second, retryAfter)
+	})
+	t.Run("half-open limits probes", func(t *testing.T) {
+		now = now.Add(6 * time.Second)
+		allowed, _, transition := b.allow()
+		assert.True(t, allowed)
+		assert.Equal(t, breakerTransition{from: BreakerOpen, to: BreakerHalfOpen}, transition)
+		allowed, _, _ = b.allow()
+		assert.False(t, allowed)
+	})
+	t.Run("failed probe reopens", func(t *testing.T) {
+		assert.Equal(t, breakerTransition{from: BreakerHalfOpen, to: BreakerOpen}, b.record(fmt.Errorf("not a status")))
+	})
+	t.Run("successful probe closes", func(t *testing.T) {
+		now = now.Add(10 * time.Second)
+		allowed, _, _ := b.allow()
+		assert.True(t, allowed)
+		assert.Equal(t, breakerTransition{from: BreakerHalfOpen, to: BreakerClosed}, b.record(nil))
+	})
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	assert.False(t, IsBackendFailure(nil))
+	assert.True(t, IsBackendFailure(fmt.Errorf("dial failed")))
+	assert.True(t, IsBackendFailure(status.Error(codes.DeadlineExceeded, "slow")))
+	assert.False(t, IsBackendFailure(status.Error(codes.InvalidArgument, "bad")))
+	assert.False(t, IsBackendFailure(status.Error(codes.Unknown, "handler bug")))
+}
+
+func TestBreaker_IsFailure(t *testing.T) {
+	handlerBug := status.Error(codes.Unknown, "handler bug")
+	b := newBreaker(BreakerConfig{FailureThreshold: 1})
+	b.allow()
+	assert.False(t, b.record(handlerBug).changed())
+	b = newBreaker(BreakerConfig{FailureThreshold: 1, IsFailure: func(err error) bool {
+		return IsBackendFailure(err) || status.Code(err) == codes.Unknown
+	}})
+	b.allow()
+	assert.Equal(t, breakerTransition{from: BreakerClosed, to: BreakerOpen}, b.record(handlerBug))
+}
+
+func TestProxy_proxyStream_failedHandshake(t *testing.T) {
+	p := NewProxy()
+	p.SetCircuitBreaker(BreakerConfig{})
+	conn := &fakeStreamConn{stream: &fakeStream{}}
+	b := p.getBreakers().get(DefaultBackendKey("GetFeed", conn))
+	b.mu.Lock()
+	b.setState(BreakerHalfOpen)
+	b.mu.Unlock()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ProxyRequest(context.Background(), w, r, "GetFeed", conn, "")
+	}))
+	defer server.Close()
+	for i := 0; i < 2; i++ {
+		// No Sec-WebSocket-Key, so the handshake fails before the handler runs
+		r, err := http.NewRequest(http.MethodGet, server.URL+"/GetFeed", nil)
+		assert.NoError(t, err)
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Connection", "Upgrade")
+		res, err := http.DefaultClient.Do(r)
+		if assert.NoError(t, err) {
+			res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, "the probe slot should be released")
+		}
+		b.mu.Lock()
+		assert.Equal(t, 0, b.halfOpenInFlight)
+		b.mu.Unlock()
+	}
+	assert.Equal(t, BreakerHalfOpen, b.getState())
+}
+
+func TestProxy_proxyUpload_unreadableBody(t *testing.T) {
+	p := NewProxy()
+	p.SetUploadProcedures("PostArchive")
+	p.SetCircuitBreaker(BreakerConfig{})
+	conn := &fakeStreamConn{stream: &fakeStream{}}
+	b := p.getBreakers().get(DefaultBackendKey("PostArchive", conn))
+	b.mu.Lock()
+	b.setState(BreakerHalfOpen)
+	b.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/PostArchive", &failingReader{data: bytes.NewReader([]byte("partial")), err: errors.New("connection reset")})
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "PostArchive", conn, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "the probe slot should be released")
+		b.mu.Lock()
+		assert.Equal(t, 0, b.halfOpenInFlight)
+		b.mu.Unlock()
+	}
+	assert.Equal(t, BreakerHalfOpen, b.getState())
+}
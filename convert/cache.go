@@ -0,0 +1,296 @@
+package convert
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LLKennedy/mercury/httpapi"
+)
+
+// CacheEntry is a cached unary response
+type CacheEntry struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Header holds the response headers, including ETag and Cache-Control
+	Header http.Header
+	// Payload is the protojson response body
+	Payload []byte
+	// Stored is when the response was cached
+	Stored time.Time
+	// Expires is when the response stops being fresh
+	Expires time.Time
+}
+
+// CacheBackend stores cached responses. Implementations must be safe for concurrent use
+type CacheBackend interface {
+	// Get returns the entry for key, if there is one
+	Get(key string) (*CacheEntry, bool)
+	// Set stores entry under key, replacing any existing entry
+	Set(key string, entry *CacheEntry)
+	// Delete removes the entry for key
+	Delete(key string)
+}
+
+// CacheConfig configures caching of GET procedure responses
+// Responses are only cached if the backend allows it with a Cache-Control max-age or s-maxage in its response metadata or headers
+type CacheConfig struct {
+	// Backend stores the cached responses, defaults to an in-memory LRU cache of 1000 entries
+	Backend CacheBackend
+	// Procedures limits caching to the named procedures, empty allows caching of any GET procedure
+	Procedures []string
+	// VaryHeaders are request headers whose values are included in the cache key
+	VaryHeaders []string
+}
+
+type responseCache struct {
+	backend     CacheBackend
+	procedures  map[string]bool
+	varyHeaders []string
+	now         func() time.Time
+}
+
+// SetCache enables or disables caching of GET procedure responses. Cached and uncached GET responses get an ETag, and If-None-Match requests which match it are answered with 304 Not Modified
+func (p *Proxy) SetCache(config *CacheConfig) {
+	if config == nil {
+		p.cache = nil
+		return
+	}
+	cache := &responseCache{
+		backend:     config.Backend,
+		procedures:  map[string]bool{},
+		varyHeaders: append([]string(nil), config.VaryHeaders...),
+		now:         time.Now,
+	}
+	if cache.backend == nil {
+		cache.backend = NewLRUCache(1000)
+	}
+	for _, procedure := range config.Procedures {
+		cache.procedures[procedure] = true
+	}
+	sort.Strings(cache.varyHeaders)
+	p.cache = cache
+}
+
+func (p *Proxy) getCache() *responseCache {
+	if p == nil {
+		return defaultProxy.cache
+	}
+	return p.cache
+}
+
+// checkCache serves the request from the cache if possible, otherwise it returns a function to offer the eventual response to the cache, if it may be cached
+func (p *Proxy) checkCache(w http.ResponseWriter, r *http.Request, req *httpapi.Request) (served bool, store func(res *unaryResponse)) {
+	cache := p.getCache()
+	if cache == nil || req.GetMethod() != httpapi.Method_GET || len(cache.procedures) > 0 && !cache.procedures[req.GetProcedure()] {
+		return false, nil
+	}
+	key := requestKey(r, req, cache.varyHeaders)
+	requestDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+	_, noCache := requestDirectives["no-cache"]
+	_, noStore := requestDirectives["no-store"]
+	if !noCache && !noStore {
+		if entry, found := cache.backend.Get(key); found {
+			now := cache.now()
+			if now.Before(entry.Expires) {
+				p.count("mercury_cache_hits", map[string]string{"procedure": req.GetProcedure()})
+				res := &unaryResponse{
+					statusCode: entry.StatusCode,
+					header:     cloneHeader(entry.Header),
+					body:       entry.Payload,
+				}
+				res.header.Set("Age", strconv.FormatInt(int64(now.Sub(entry.Stored)/time.Second), 10))
+				res.write(w, r)
+				return true, nil
+			}
+			cache.backend.Delete(key)
+		}
+	}
+	p.count("mercury_cache_misses", map[string]string{"procedure": req.GetProcedure()})
+	return false, func(res *unaryResponse) {
+		if res.statusCode != http.StatusOK {
+			return
+		}
+		if res.header.Get("ETag") == "" {
+			res.header.Set("ETag", computeETag(res.body))
+		}
+		maxAge, cacheable := cacheLifetime(res.header.Get("Cache-Control"))
+		if !cacheable || noStore {
+			return
+		}
+		now := cache.now()
+		cache.backend.Set(key, &CacheEntry{
+			StatusCode: res.statusCode,
+			Header:     cloneHeader(res.header),
+			Payload:    res.body,
+			Stored:     now,
+			Expires:    now.Add(maxAge),
+		})
+	}
+}
+
+// requestKey combines the procedure, escaped path, normalised params and vary headers into a key identifying equivalent requests
+func requestKey(r *http.Request, req *httpapi.Request, varyHeaders []string) string {
+	hash := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			hash.Write([]byte(strconv.Itoa(len(part))))
+			hash.Write([]byte{':'})
+			hash.Write([]byte(part))
+		}
+	}
+	// Path templates put resource names in the path, so it distinguishes requests as much as the params do
+	write(req.GetProcedure())
+	write(req.GetHeaders()[PathHeader].GetValues()...)
+	names := make([]string, 0, len(req.GetParams()))
+	for name := range req.GetParams() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := req.GetParams()[name].GetValues()
+		write("p", name, strconv.Itoa(len(values)))
+		write(values...)
+	}
+	for _, name := range varyHeaders {
+		values := r.Header[http.CanonicalHeaderKey(name)]
+		write("h", name, strconv.Itoa(len(values)))
+		write(values...)
+	}
+	return req.GetProcedure() + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// computeETag returns a strong ETag for a response payload
+func computeETag(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison used by If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCacheControl splits a Cache-Control header into its lower-cased directives and their values
+func parseCacheControl(header string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return directives
+}
+
+// cacheLifetime returns how long a response may be cached according to its Cache-Control header
+func cacheLifetime(header string) (maxAge time.Duration, cacheable bool) {
+	directives := parseCacheControl(header)
+	for _, forbidden := range []string{"no-store", "no-cache", "private"} {
+		if _, found := directives[forbidden]; found {
+			return 0, false
+		}
+	}
+	value, found := directives["s-maxage"]
+	if !found {
+		value, found = directives["max-age"]
+	}
+	if !found {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// lruCache is an in-memory CacheBackend which evicts the least recently used entry when full
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCache creates an in-memory CacheBackend holding at most size entries
+func NewLRUCache(size int) CacheBackend {
+	if size <= 0 {
+		size = 1
+	}
+	return &lruCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *lruCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem).entry, true
+}
+
+func (c *lruCache) Set(key string, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, found := c.entries[key]; found {
+		element.Value.(*lruItem).entry = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruItem).key)
+	}
+}
+
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, found := c.entries[key]; found {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,130 @@
+package convert
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy_checkCache(t *testing.T) {
+	now := time.Unix(1000, 0)
+	p := NewProxy()
+	p.SetCache(&CacheConfig{VaryHeaders: []string{"Accept-Language"}})
+	p.cache.now = func() time.Time { return now }
+	newRequest := func(language, ifNoneMatch string) (*http.Request, *httpapi.Request) {
+		r := httptest.NewRequest(http.MethodGet, "/Random?upperBound=10&lowerBound=1", nil)
+		r.Header.Set("Accept-Language", language)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		req := RequestFromRequest(r)
+		req.Procedure = "Random"
+		return r, req
+	}
+	r, req := newRequest("en", "")
+	w := httptest.NewRecorder()
+	served, store := p.checkCache(w, r, req)
+	assert.False(t, served)
+	res := &unaryResponse{
+		statusCode: http.StatusOK,
+		header:     http.Header{"Cache-Control": {"max-age=60"}},
+		body:       []byte(`{"number":"7"}`),
+	}
+	store(res)
+	etag := res.header.Get("ETag")
+	assert.Equal(t, computeETag(res.body), etag)
+	t.Run("hit", func(t *testing.T) {
+		now = now.Add(10 * time.Second)
+		r, req := newRequest("en", "")
+		w := httptest.NewRecorder()
+		served, _ := p.checkCache(w, r, req)
+		assert.True(t, served)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"number":"7"}`, w.Body.String())
+		assert.Equal(t, "10", w.Header().Get("Age"))
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+	})
+	t.Run("not modified", func(t *testing.T) {
+		r, req := newRequest("en", `"other", `+etag)
+		w := httptest.NewRecorder()
+		served, _ := p.checkCache(w, r, req)
+		assert.True(t, served)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+	t.Run("vary header miss", func(t *testing.T) {
+		r, req := newRequest("fr", "")
+		served, _ := p.checkCache(httptest.NewRecorder(), r, req)
+		assert.False(t, served)
+	})
+	t.Run("path miss", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/photos/1", nil)
+		req := RequestFromRequest(r)
+		req.Procedure = "Photo"
+		_, store := p.checkCache(httptest.NewRecorder(), r, req)
+		store(&unaryResponse{statusCode: http.StatusOK, header: http.Header{"Cache-Control": {"max-age=60"}}, body: []byte(`{"id":"1"}`)})
+		r = httptest.NewRequest(http.MethodGet, "/v1/photos/2", nil)
+		req = RequestFromRequest(r)
+		req.Procedure = "Photo"
+		served, _ := p.checkCache(httptest.NewRecorder(), r, req)
+		assert.False(t, served)
+	})
+	t.Run("expired", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		r, req := newRequest("en", "")
+		served, _ := p.checkCache(httptest.NewRecorder(), r, req)
+		assert.False(t, served)
+	})
+	t.Run("not GET", func(t *testing.T) {
+		r, req := newRequest("en", "")
+		req.Method = httpapi.Method_POST
+		served, store := p.checkCache(httptest.NewRecorder(), r, req)
+		assert.False(t, served)
+		assert.Nil(t, store)
+	})
+}
+
+func Test_cacheLifetime(t *testing.T) {
+	tests := []struct {
+		header    string
+		maxAge    time.Duration
+		cacheable bool
+	}{
+		{header: ""},
+		{header: "max-age=60", maxAge: time.Minute, cacheable: true},
+		{header: "public, max-age=60, s-maxage=120", maxAge: 2 * time.Minute, cacheable: true},
+		{header: "private, max-age=60"},
+		{header: "no-store"},
+		{header: "max-age=0"},
+		{header: "max-age=abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			maxAge, cacheable := cacheLifetime(tt.header)
+			assert.Equal(t, tt.maxAge, maxAge)
+			assert.Equal(t, tt.cacheable, cacheable)
+		})
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2)
+	a, b, d := &CacheEntry{StatusCode: 1}, &CacheEntry{StatusCode: 2}, &CacheEntry{StatusCode: 3}
+	c.Set("a", a)
+	c.Set("b", b)
+	got, found := c.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, a, got)
+	c.Set("d", d)
+	_, found = c.Get("b")
+	assert.False(t, found)
+	_, found = c.Get("a")
+	assert.True(t, found)
+	c.Delete("a")
+	_, found = c.Get("a")
+	assert.False(t, found)
+}
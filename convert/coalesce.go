@@ -0,0 +1,155 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// ReasonCancelled is the ErrorInfo reason given when a request is cancelled while waiting for an identical request to finish
+	ReasonCancelled = "CANCELLED"
+	// ReasonCoalescedCallFailed is the ErrorInfo reason given when the backend call shared by identical requests panics
+	ReasonCoalescedCallFailed = "COALESCED_CALL_FAILED"
+)
+
+// CoalesceConfig configures deduplication of identical concurrent GET requests into a single backend call
+type CoalesceConfig struct {
+	// Procedures are the GET procedures whose requests may be coalesced. Only include procedures whose responses don't depend on headers other than VaryHeaders
+	Procedures []string
+	// VaryHeaders are request headers whose values must also match for requests to be coalesced
+	VaryHeaders []string
+	// Timeout bounds the shared backend call, which isn't cancelled until every request waiting for it has gone. Defaults to 30 seconds
+	Timeout time.Duration
+}
+
+type coalescer struct {
+	mu          sync.Mutex
+	procedures  map[string]bool
+	varyHeaders []string
+	timeout     time.Duration
+	calls       map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done    chan struct{}
+	res     *unaryResponse
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// detachedContext keeps the values of a context, such as its outgoing metadata, without its deadline or cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// SetCoalescing enables coalescing for the configured procedures, all concurrent identical requests share the response of whichever arrived first
+// Passing no procedures disables coalescing
+func (p *Proxy) SetCoalescing(config CoalesceConfig) {
+	if len(config.Procedures) == 0 {
+		p.coalescer = nil
+		return
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	c := &coalescer{
+		procedures:  map[string]bool{},
+		varyHeaders: append([]string(nil), config.VaryHeaders...),
+		timeout:     config.Timeout,
+		calls:       map[string]*coalescedCall{},
+	}
+	for _, procedure := range config.Procedures {
+		c.procedures[procedure] = true
+	}
+	sort.Strings(c.varyHeaders)
+	p.coalescer = c
+}
+
+func (p *Proxy) getCoalescer() *coalescer {
+	if p == nil {
+		return defaultProxy.coalescer
+	}
+	return p.coalescer
+}
+
+// coalesce runs call, or waits for an identical in-flight request to finish and shares its response instead. Every caller gets its own copy of the response.
+// The shared call runs with the values of the context of the request which started it, but is only cancelled once every request waiting for it has gone
+func (p *Proxy) coalesce(ctx context.Context, r *http.Request, req *httpapi.Request, txid string, loggers []logs.Writer, call func(ctx context.Context) *unaryResponse) *unaryResponse {
+	c := p.getCoalescer()
+	if c == nil || req.GetMethod() != httpapi.Method_GET || !c.procedures[req.GetProcedure()] {
+		return call(ctx)
+	}
+	key := requestKey(r, req, c.varyHeaders)
+	c.mu.Lock()
+	shared, found := c.calls[key]
+	if found {
+		shared.waiters++
+	} else {
+		sharedCtx, cancel := context.WithTimeout(detachedContext{ctx}, c.timeout)
+		shared = &coalescedCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.calls[key] = shared
+		go c.run(sharedCtx, key, shared, txid, loggers, call)
+	}
+	c.mu.Unlock()
+	if found {
+		p.count("mercury_coalesced_requests", map[string]string{"procedure": req.GetProcedure()})
+	}
+	select {
+	case <-shared.done:
+		if shared.res == nil {
+			capture := newResponseCapture()
+			writeStatusError(capture, http.StatusInternalServerError, codes.Internal, ReasonCoalescedCallFailed, "mercury: identical request failed", 0)
+			return capture.response()
+		}
+		return shared.res.clone()
+	case <-ctx.Done():
+		c.leave(key, shared)
+		capture := newResponseCapture()
+		writeStatusError(capture, GRPCStatusToHTTPStatusCode(codes.Canceled), codes.Canceled, ReasonCancelled, "mercury: request cancelled while waiting for identical request", 0)
+		return capture.response()
+	}
+}
+
+// run makes the shared call, leaving its response nil if it panics
+func (c *coalescer) run(ctx context.Context, key string, shared *coalescedCall, txid string, loggers []logs.Writer, call func(ctx context.Context) *unaryResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			for _, logger := range loggers {
+				logger.LogErrorf(txid, "mercury: caught panic in coalesced request: %v", r)
+			}
+		}
+		c.mu.Lock()
+		if c.calls[key] == shared {
+			delete(c.calls, key)
+		}
+		c.mu.Unlock()
+		shared.cancel()
+		close(shared.done)
+	}()
+	shared.res = call(ctx)
+}
+
+// leave stops waiting for a shared call, cancelling it once nobody is waiting. New identical requests start a call of their own rather than sharing the cancelled one
+func (c *coalescer) leave(key string, shared *coalescedCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	shared.waiters--
+	if shared.waiters > 0 {
+		return
+	}
+	if c.calls[key] == shared {
+		delete(c.calls, key)
+	}
+	shared.cancel()
+}
@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy_coalesce(t *testing.T) {
+	p := NewProxy()
+	p.SetCoalescing(CoalesceConfig{Procedures: []string{"Random"}})
+	recorder := &coalesceRecorder{}
+	p.SetMetrics(recorder)
+	newRequest := func(target string) (*http.Request, *httpapi.Request) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		req := RequestFromRequest(r)
+		req.Procedure = "Random"
+		return r, req
+	}
+	t.Run("identical requests share one call", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		started := make(chan struct{})
+		call := func(ctx context.Context) *unaryResponse {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(started)
+			}
+			<-release
+			return &unaryResponse{statusCode: http.StatusOK, header: http.Header{}, body: []byte(`{"number":"7"}`)}
+		}
+		results := make([]*unaryResponse, 3)
+		wg := sync.WaitGroup{}
+		r, req := newRequest("/Random?upperBound=10")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[0] = p.coalesce(context.Background(), r, req, "", nil, call)
+		}()
+		<-started
+		for i := 1; i < len(results); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				r, req := newRequest("/Random?upperBound=10")
+				results[i] = p.coalesce(context.Background(), r, req, "", nil, call)
+			}(i)
+		}
+		for atomic.LoadInt64(&recorder.coalesced) < int64(len(results)-1) {
+			runtime.Gosched()
+		}
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(1), calls)
+		for _, res := range results {
+			assert.Equal(t, `{"number":"7"}`, string(res.body))
+		}
+		results[0].header.Set("ETag", `"x"`)
+		assert.Empty(t, results[1].header.Get("ETag"))
+	})
+	inFlight := func() int {
+		p.coalescer.mu.Lock()
+		defer p.coalescer.mu.Unlock()
+		return len(p.coalescer.calls)
+	}
+	// share starts a call shared by a first request with leaderCtx and followers identical requests, returning their responses once it finishes
+	share := func(call func(ctx context.Context) *unaryResponse, leaderCtx context.Context, followers int) (leader chan *unaryResponse, results chan *unaryResponse) {
+		started := atomic.LoadInt64(&recorder.coalesced)
+		leader = make(chan *unaryResponse, 1)
+		results = make(chan *unaryResponse, followers)
+		r, req := newRequest("/Random?upperBound=30")
+		go func() { leader <- p.coalesce(leaderCtx, r, req, "", nil, call) }()
+		for inFlight() == 0 {
+			runtime.Gosched()
+		}
+		for i := 0; i < followers; i++ {
+			go func() {
+				r, req := newRequest("/Random?upperBound=30")
+				results <- p.coalesce(context.Background(), r, req, "", nil, call)
+			}()
+		}
+		for atomic.LoadInt64(&recorder.coalesced) < started+int64(followers) {
+			runtime.Gosched()
+		}
+		return leader, results
+	}
+	t.Run("leader leaving doesn't cancel the shared call", func(t *testing.T) {
+		release := make(chan struct{})
+		call := func(ctx context.Context) *unaryResponse {
+			<-release
+			if ctx.Err() != nil {
+				return &unaryResponse{statusCode: http.StatusRequestTimeout, header: http.Header{}}
+			}
+			return &unaryResponse{statusCode: http.StatusOK, header: http.Header{}, body: []byte(`{"number":"7"}`)}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		leader, results := share(call, ctx, 1)
+		cancel()
+		assert.Contains(t, string((<-leader).body), ReasonCancelled)
+		close(release)
+		assert.Equal(t, http.StatusOK, (<-results).statusCode)
+	})
+	t.Run("shared call is cancelled once everyone has gone", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		call := func(ctx context.Context) *unaryResponse {
+			<-ctx.Done()
+			close(cancelled)
+			return &unaryResponse{statusCode: http.StatusRequestTimeout, header: http.Header{}}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		leader, _ := share(call, ctx, 0)
+		cancel()
+		<-leader
+		<-cancelled
+		assert.Equal(t, 0, inFlight())
+	})
+	t.Run("leader panics", func(t *testing.T) {
+		release := make(chan struct{})
+		call := func(ctx context.Context) *unaryResponse {
+			<-release
+			panic("disk on fire")
+		}
+		leader, results := share(call, context.Background(), 2)
+		close(release)
+		for _, res := range []*unaryResponse{<-leader, <-results, <-results} {
+			assert.Equal(t, http.StatusInternalServerError, res.statusCode)
+			assert.Contains(t, string(res.body), ReasonCoalescedCallFailed)
+		}
+	})
+	t.Run("different params are not coalesced", func(t *testing.T) {
+		r1, req1 := newRequest("/Random?upperBound=10")
+		r2, req2 := newRequest("/Random?upperBound=20")
+		assert.NotEqual(t, requestKey(r1, req1, nil), requestKey(r2, req2, nil))
+	})
+	t.Run("different paths are not coalesced", func(t *testing.T) {
+		r1, req1 := newRequest("/v1/photos/1")
+		r2, req2 := newRequest("/v1/photos/2")
+		assert.NotEqual(t, requestKey(r1, req1, nil), requestKey(r2, req2, nil))
+	})
+	t.Run("not opted in", func(t *testing.T) {
+		var calls int32
+		r, req := newRequest("/Other")
+		req.Procedure = "Other"
+		call := func(ctx context.Context) *unaryResponse {
+			atomic.AddInt32(&calls, 1)
+			return &unaryResponse{statusCode: http.StatusOK, header: http.Header{}}
+		}
+		p.coalesce(context.Background(), r, req, "", nil, call)
+		p.coalesce(context.Background(), r, req, "", nil, call)
+		assert.Equal(t, int32(2), calls)
+		assert.Empty(t, p.coalescer.calls)
+	})
+}
+
+type coalesceRecorder struct {
+	coalesced int64
+}
+
+func (c *coalesceRecorder) Count(name string, delta int64, tags map[string]string) {
+	if name == "mercury_coalesced_requests" {
+		atomic.AddInt64(&c.coalesced, delta)
+	}
+}
+
+func (c *coalesceRecorder) Gauge(name string, value float64, tags map[string]string) {}
@@ -0,0 +1,62 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ReasonPreconditionFailed is the ErrorInfo reason of FailedPrecondition errors which are written as 412 Precondition Failed, see PreconditionFailed
+const ReasonPreconditionFailed = "PRECONDITION_FAILED"
+
+// conditionalHeaders are forwarded to the backend as metadata, so handlers can compare them to the current ETag of what they update
+var conditionalHeaders = []string{"If-Match", "If-None-Match"}
+
+// PreconditionFailed returns the error a handler should return when the If-Match or If-None-Match metadata of a request doesn't match the current ETag.
+// It is written as 412 Precondition Failed, along with any ErrorInfo reason ReasonPreconditionFailed in any domain
+func PreconditionFailed(message string) error {
+	errStatus, err := status.New(codes.FailedPrecondition, message).WithDetails(&errdetails.ErrorInfo{
+		Reason: ReasonPreconditionFailed,
+		Domain: ErrorDomain,
+	})
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, message)
+	}
+	return errStatus.Err()
+}
+
+// withConditionalMetadata adds the conditional headers of r to the outgoing metadata of ctx, as if-match and if-none-match
+func withConditionalMetadata(ctx context.Context, r *http.Request) context.Context {
+	for _, name := range conditionalHeaders {
+		for _, value := range r.Header[name] {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(name), value)
+		}
+	}
+	return ctx
+}
+
+// isPreconditionFailed is true for FailedPrecondition errors with the ErrorInfo reason ReasonPreconditionFailed
+func isPreconditionFailed(errStatus *status.Status) bool {
+	if errStatus.Code() != codes.FailedPrecondition {
+		return false
+	}
+	for _, detail := range errStatus.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetReason() == ReasonPreconditionFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// httpStatusFromError returns the HTTP status code for a gRPC error
+func httpStatusFromError(errStatus *status.Status) int {
+	if isPreconditionFailed(errStatus) {
+		return http.StatusPreconditionFailed
+	}
+	return GRPCStatusToHTTPStatusCode(errStatus.Code())
+}
@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// etagConn answers ProxyUnary calls with an etag header and err, recording the metadata it receives
+type etagConn struct {
+	fakeStreamConn
+	etag     string
+	err      error
+	received metadata.MD
+}
+
+func (e *etagConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	e.received, _ = metadata.FromOutgoingContext(ctx)
+	for _, opt := range opts {
+		if header, ok := opt.(grpc.HeaderCallOption); ok {
+			*header.HeaderAddr = metadata.Pairs("etag", e.etag)
+		}
+	}
+	if e.err != nil {
+		return e.err
+	}
+	*reply.(*httpapi.Response) = httpapi.Response{StatusCode: http.StatusOK, Payload: []byte(`{"title":"cat"}`)}
+	return nil
+}
+
+func TestProxy_conditionalRequests(t *testing.T) {
+	p := NewProxy()
+	call := func(conn *etagConn, method, ifMatch, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/Photo", strings.NewReader(`{"title":"dog"}`))
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, method+"Photo", conn, "")
+		return w
+	}
+	t.Run("handler ETag", func(t *testing.T) {
+		conn := &etagConn{etag: `"v2"`}
+		w := call(conn, http.MethodGet, "", `"v1"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v2"`, w.Header().Get("ETag"))
+		assert.Equal(t, []string{`"v1"`}, conn.received.Get("if-none-match"))
+		w = call(conn, http.MethodGet, "", `"v1", W/"v2"`)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+	t.Run("If-Match forwarded", func(t *testing.T) {
+		conn := &etagConn{etag: `"v3"`}
+		w := call(conn, http.MethodPut, `"v2"`, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{`"v2"`}, conn.received.Get("if-match"))
+		assert.Equal(t, `"v3"`, w.Header().Get("ETag"))
+	})
+	t.Run("precondition failed", func(t *testing.T) {
+		w := call(&etagConn{err: PreconditionFailed("photo has changed")}, http.MethodPut, `"v1"`, "")
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonPreconditionFailed)
+	})
+	t.Run("other failed preconditions", func(t *testing.T) {
+		w := call(&etagConn{err: status.Error(codes.FailedPrecondition, "album is archived")}, http.MethodPut, "", "")
+		assert.Equal(t, GRPCStatusToHTTPStatusCode(codes.FailedPrecondition), w.Code)
+		assert.Equal(t, "album is archived", w.Body.String())
+	})
+}
+
+func TestProxy_ProxyRequest_txid(t *testing.T) {
+	conn := &etagConn{}
+	NewProxy().ProxyRequest(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/Photo", nil), "GetPhoto", conn, "tx-1")
+	assert.Equal(t, []string{"tx-1"}, conn.received.Get(TxidMetadata))
+	NewProxy().ProxyRequest(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/Photo", nil), "GetPhoto", conn, "")
+	assert.Empty(t, conn.received.Get(TxidMetadata))
+}
+
+func TestProxy_ProxyRequest_errorDetails(t *testing.T) {
+	call := func(err error) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		NewProxy().ProxyRequest(context.Background(), w, httptest.NewRequest(http.MethodGet, "/Photo", nil), "GetPhoto", &etagConn{err: err}, "")
+		return w
+	}
+	t.Run("invalid fields", func(t *testing.T) {
+		w := call(InvalidFields("bad photo", []*errdetails.BadRequest_FieldViolation{{Field: "width", Description: "width must be at most 4096"}}))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "width must be at most 4096")
+	})
+	t.Run("backend details stay private", func(t *testing.T) {
+		errStatus, _ := status.New(codes.InvalidArgument, "bad photo").WithDetails(&errdetails.DebugInfo{Detail: "stack trace"})
+		w := call(errStatus.Err())
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "bad photo", w.Body.String())
+	})
+}
@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc"
+)
+
+const (
+	// DownloadHeader is set on the routing information of download streams to the request's raw query string, telling the backend to build the request from it and stream raw chunks back
+	DownloadHeader = "X-Mercury-Download"
+	// ContentTypeMetadata is the response metadata key the backend uses for the Content-Type of a download, as gRPC uses content-type itself
+	ContentTypeMetadata = "mercury-content-type"
+)
+
+// SetDownloadProcedures sets the server-streaming procedures which are served to GET requests as plain chunked HTTP downloads rather than over a websocket.
+// The backend must know which field of the procedure's response messages holds each chunk, see proxy.Server.SetDownload
+func (p *Proxy) SetDownloadProcedures(procedures ...string) {
+	downloads := map[string]bool{}
+	for _, procedure := range procedures {
+		downloads[procedure] = true
+	}
+	p.downloads = downloads
+}
+
+// isDownload is true if the request should be served as a chunked download
+func (p *Proxy) isDownload(r *http.Request, procedure string) bool {
+	downloads := defaultProxy.downloads
+	if p != nil {
+		downloads = p.downloads
+	}
+	return downloads[procedure] && r.Method == http.MethodGet
+}
+
+// proxyDownload streams the responses of a server-streaming procedure to the client as the chunks of a single HTTP response
+func (p *Proxy) proxyDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, txid string, loggers []logs.Writer) {
+	capture := newResponseCapture()
+	conn, release, record, ok := p.prepareBackend(ctx, capture, r, procedure, conn, txid, loggers)
+	if !ok {
+		capture.response().write(w, r)
+		return
+	}
+	defer release()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client, err := httpapi.NewExposedServiceClient(conn).ProxyStream(withConditionalMetadata(ctx, r))
+	if err == nil {
+		req := RequestFromRequest(r)
+		req.Headers[DownloadHeader] = &httpapi.MultiVal{Values: []string{r.URL.RawQuery}}
+		err = client.Send(&httpapi.StreamedRequest{
+			MessageType: &httpapi.StreamedRequest_Init{
+				Init: &httpapi.RoutingInformation{
+					Method:    httpapi.Method_GET,
+					Procedure: procedure,
+					Headers:   req.GetHeaders(),
+				},
+			},
+		})
+	}
+	if err == nil {
+		err = client.CloseSend()
+	}
+	var chunk *httpapi.StreamedResponse
+	if err == nil {
+		chunk, err = recvData(client)
+	}
+	if err == io.EOF {
+		record(nil)
+	} else {
+		record(err)
+	}
+	if err != nil && err != io.EOF {
+		for _, logger := range loggers {
+			logger.LogErrorf(txid, "mercury: received error from target service: %v", err)
+		}
+		newUnaryResponse(nil, nil, err).write(w, r)
+		return
+	}
+	md, _ := client.Header()
+	header := headersFromMetadata(md)
+	if contentType := md.Get(ContentTypeMetadata); len(contentType) > 0 {
+		header.Del(ContentTypeMetadata)
+		header.Set("Content-Type", contentType[0])
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for chunk != nil {
+		if _, err = w.Write(chunk.GetResponse()); err != nil {
+			// The client has gone, cancelling ctx stops the backend too
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		chunk, err = recvData(client)
+	}
+	if err != io.EOF {
+		for _, logger := range loggers {
+			logger.LogErrorf(txid, "mercury: download of %s failed after it started: %v", procedure, err)
+		}
+		// The status has already been sent, aborting the response is the only way left to tell the client the download is incomplete
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// recvData receives the next message with a response, skipping go-away signals which are only passed on to websocket clients
+func recvData(client httpapi.ExposedService_ProxyStreamClient) (*httpapi.StreamedResponse, error) {
+	for {
+		res, err := client.Recv()
+		if err != nil || !res.GetGoingAway() {
+			return res, err
+		}
+	}
+}
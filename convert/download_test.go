@@ -0,0 +1,117 @@
+package convert
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStreamConn answers ProxyStream calls with a fakeStream
+type fakeStreamConn struct {
+	stream *fakeStream
+}
+
+func (f *fakeStreamConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return status.Error(codes.Unimplemented, "unary calls not supported")
+}
+
+func (f *fakeStreamConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return f.stream, nil
+}
+
+// fakeStream records the messages sent on it and replies with responses, then err (or io.EOF if err is nil)
+type fakeStream struct {
+	grpc.ClientStream
+	header metadata.MD
+	sent   []*httpapi.StreamedRequest
+	closed bool
+	// A nil response is received as a go-away signal
+	responses [][]byte
+	err       error
+}
+
+func (f *fakeStream) Header() (metadata.MD, error) {
+	return f.header, nil
+}
+
+func (f *fakeStream) CloseSend() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeStream) SendMsg(m interface{}) error {
+	f.sent = append(f.sent, m.(*httpapi.StreamedRequest))
+	return nil
+}
+
+func (f *fakeStream) RecvMsg(m interface{}) error {
+	if len(f.responses) == 0 {
+		if f.err != nil {
+			return f.err
+		}
+		return io.EOF
+	}
+	m.(*httpapi.StreamedResponse).Response = f.responses[0]
+	m.(*httpapi.StreamedResponse).GoingAway = f.responses[0] == nil
+	f.responses = f.responses[1:]
+	return nil
+}
+
+func TestProxy_proxyDownload(t *testing.T) {
+	p := NewProxy()
+	p.SetDownloadProcedures("GetExport")
+	download := func(stream *fakeStream) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/GetExport?format=csv&year=2020", nil)
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "GetExport", &fakeStreamConn{stream: stream}, "")
+		return w
+	}
+	t.Run("chunks", func(t *testing.T) {
+		stream := &fakeStream{
+			header:    metadata.Pairs(ContentTypeMetadata, "text/csv", "content-disposition", `attachment; filename="export.csv"`),
+			responses: [][]byte{[]byte("id,name\n"), []byte("1,cat\n")},
+		}
+		w := download(stream)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "id,name\n1,cat\n", w.Body.String())
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="export.csv"`, w.Header().Get("Content-Disposition"))
+		assert.Empty(t, w.Header().Get(ContentTypeMetadata))
+		assert.True(t, stream.closed)
+		if assert.Len(t, stream.sent, 1) {
+			init := stream.sent[0].GetInit()
+			assert.Equal(t, "GetExport", init.GetProcedure())
+			assert.Equal(t, []string{"format=csv&year=2020"}, init.GetHeaders()[DownloadHeader].GetValues())
+		}
+	})
+	t.Run("going away", func(t *testing.T) {
+		w := download(&fakeStream{responses: [][]byte{nil, []byte("id,name\n"), nil, []byte("1,cat\n")}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "id,name\n1,cat\n", w.Body.String())
+		w = download(&fakeStream{responses: [][]byte{nil}, err: status.Error(codes.NotFound, "no such export")})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("error before the first chunk", func(t *testing.T) {
+		w := download(&fakeStream{err: status.Error(codes.NotFound, "no such export")})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "no such export", w.Body.String())
+	})
+	t.Run("error after the first chunk", func(t *testing.T) {
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			download(&fakeStream{responses: [][]byte{[]byte("partial")}, err: status.Error(codes.Internal, "disk on fire")})
+		})
+	})
+	t.Run("other methods aren't downloads", func(t *testing.T) {
+		assert.False(t, p.isDownload(httptest.NewRequest(http.MethodPost, "/GetExport", nil), "GetExport"))
+		assert.False(t, p.isDownload(httptest.NewRequest(http.MethodGet, "/GetPhoto", nil), "GetPhoto"))
+	})
+}
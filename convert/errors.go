@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorDomain is the domain of every google.rpc.ErrorInfo detail mercury generates itself
+const ErrorDomain = "mercury"
+
+const (
+	// ReasonCircuitOpen is the ErrorInfo reason given when a request is rejected by an open circuit breaker
+	ReasonCircuitOpen = "CIRCUIT_OPEN"
+	// ReasonInvalidFields is the ErrorInfo reason of InvalidArgument errors listing invalid fields in a google.rpc.BadRequest detail, see InvalidFields
+	ReasonInvalidFields = "INVALID_FIELDS"
+)
+
+// InvalidFields returns the error a validator should return for a request with invalid fields.
+// Like every error with an ErrorInfo detail in ErrorDomain, it is written as the JSON google.rpc.Status so the client gets the violations
+func InvalidFields(message string, violations []*errdetails.BadRequest_FieldViolation) error {
+	errStatus, err := status.New(codes.InvalidArgument, message).WithDetails(&errdetails.ErrorInfo{
+		Reason: ReasonInvalidFields,
+		Domain: ErrorDomain,
+	}, &errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, message)
+	}
+	return errStatus.Err()
+}
+
+// isMercuryError is true for errors with an ErrorInfo detail in ErrorDomain, whose details are meant for the client, other errors only send their message
+func isMercuryError(errStatus *status.Status) bool {
+	for _, detail := range errStatus.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == ErrorDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// writeStatusError writes a structured JSON google.rpc.Status error generated by mercury rather than the backend
+func writeStatusError(w http.ResponseWriter, httpCode int, code codes.Code, reason string, message string, retryAfter time.Duration) {
+	errStatus := status.New(code, message)
+	info := &errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: ErrorDomain,
+	}
+	if withDetails, err := errStatus.WithDetails(info); err == nil {
+		errStatus = withDetails
+	}
+	if retryAfter > 0 {
+		seconds := int64((retryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		if withDetails, err := errStatus.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+			errStatus = withDetails
+		}
+	}
+	body, err := protojson.Marshal(errStatus.Proto())
+	if err != nil {
+		body = []byte(message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	w.Write(body)
+}
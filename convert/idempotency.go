@@ -0,0 +1,227 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// ReasonIdempotencyConflict is the ErrorInfo reason given when a request arrives while another with the same Idempotency-Key is still in flight
+	ReasonIdempotencyConflict = "IDEMPOTENCY_CONFLICT"
+	// ReasonIdempotencyMismatch is the ErrorInfo reason given when an Idempotency-Key is reused for a different request
+	ReasonIdempotencyMismatch = "IDEMPOTENCY_MISMATCH"
+	// IdempotentReplayedHeader is set to true on responses replayed from the idempotency store
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyRecord is the state of a single Idempotency-Key
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request which first used the key, so the key can't be reused for a different request
+	Fingerprint string
+	// Complete is false while the first request is still in flight
+	Complete bool
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Header holds the response headers
+	Header http.Header
+	// Payload is the response body
+	Payload []byte
+	// Expires is when the key may be used again
+	Expires time.Time
+}
+
+// IdempotencyStore stores the state of Idempotency-Keys. Implementations must be safe for concurrent use and must ignore expired records
+type IdempotencyStore interface {
+	// Reserve stores record under key unless there is already an unexpired record, which is returned instead
+	Reserve(key string, record *IdempotencyRecord) (existing *IdempotencyRecord, reserved bool)
+	// Complete replaces the reserved record under key with the record holding its response
+	Complete(key string, record *IdempotencyRecord)
+	// Release removes the record under key, so the request may be retried
+	Release(key string)
+}
+
+// IdempotencyConfig configures Idempotency-Key support for unsafe methods
+type IdempotencyConfig struct {
+	// Store holds the keys and their responses, defaults to an in-memory store
+	Store IdempotencyStore
+	// TTL is how long a response is replayed for, defaults to 24 hours
+	TTL time.Duration
+	// Procedures limits idempotency to the named procedures, empty allows it for any POST, PUT or PATCH procedure
+	Procedures []string
+	// VaryHeaders are request headers whose values are included in the key, such as Authorization, so different clients can't see each other's responses
+	VaryHeaders []string
+}
+
+type idempotency struct {
+	store       IdempotencyStore
+	ttl         time.Duration
+	procedures  map[string]bool
+	varyHeaders []string
+	now         func() time.Time
+}
+
+// SetIdempotency enables or disables Idempotency-Key support. POST, PUT and PATCH requests with an Idempotency-Key header get the first response for that key replayed until the TTL expires,
+// a request arriving while the first is in flight gets 409 Conflict and reusing a key for a different request gets 422 Unprocessable Entity.
+// Responses with a 5xx or 429 status aren't stored, so the request may be retried
+func (p *Proxy) SetIdempotency(config *IdempotencyConfig) {
+	if config == nil {
+		p.idempotency = nil
+		return
+	}
+	i := &idempotency{
+		store:       config.Store,
+		ttl:         config.TTL,
+		procedures:  map[string]bool{},
+		varyHeaders: append([]string(nil), config.VaryHeaders...),
+		now:         time.Now,
+	}
+	if i.store == nil {
+		i.store = NewMemoryIdempotencyStore()
+	}
+	if i.ttl <= 0 {
+		i.ttl = 24 * time.Hour
+	}
+	for _, procedure := range config.Procedures {
+		i.procedures[procedure] = true
+	}
+	sort.Strings(i.varyHeaders)
+	p.idempotency = i
+}
+
+func (p *Proxy) getIdempotency() *idempotency {
+	if p == nil {
+		return defaultProxy.idempotency
+	}
+	return p.idempotency
+}
+
+// checkIdempotency replays or rejects the request if its Idempotency-Key has been seen, otherwise it returns a function to record the eventual response, or release the key if the response is nil
+func (p *Proxy) checkIdempotency(w http.ResponseWriter, r *http.Request, req *httpapi.Request) (served bool, complete func(res *unaryResponse)) {
+	i := p.getIdempotency()
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if i == nil || idempotencyKey == "" || len(i.procedures) > 0 && !i.procedures[req.GetProcedure()] {
+		return false, nil
+	}
+	switch req.GetMethod() {
+	case httpapi.Method_POST, httpapi.Method_PUT, httpapi.Method_PATCH:
+	default:
+		return false, nil
+	}
+	key := idempotencyStoreKey(r, idempotencyKey, i.varyHeaders)
+	fingerprint := idempotencyFingerprint(req)
+	existing, reserved := i.store.Reserve(key, &IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Expires:     i.now().Add(i.ttl),
+	})
+	if !reserved {
+		tags := map[string]string{"procedure": req.GetProcedure()}
+		switch {
+		case existing.Fingerprint != fingerprint:
+			p.count("mercury_idempotency_mismatches", tags)
+			writeStatusError(w, http.StatusUnprocessableEntity, codes.InvalidArgument, ReasonIdempotencyMismatch, "mercury: Idempotency-Key was already used for a different request", 0)
+		case !existing.Complete:
+			p.count("mercury_idempotency_conflicts", tags)
+			writeStatusError(w, http.StatusConflict, codes.Aborted, ReasonIdempotencyConflict, "mercury: a request with this Idempotency-Key is still in progress", 0)
+		default:
+			p.count("mercury_idempotency_replays", tags)
+			res := &unaryResponse{
+				statusCode: existing.StatusCode,
+				header:     cloneHeader(existing.Header),
+				body:       existing.Payload,
+			}
+			res.header.Set(IdempotentReplayedHeader, "true")
+			res.write(w, r)
+		}
+		return true, nil
+	}
+	return false, func(res *unaryResponse) {
+		if res == nil || res.statusCode >= http.StatusInternalServerError || res.statusCode == http.StatusTooManyRequests {
+			i.store.Release(key)
+			return
+		}
+		i.store.Complete(key, &IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Complete:    true,
+			StatusCode:  res.statusCode,
+			Header:      cloneHeader(res.header),
+			Payload:     res.body,
+			Expires:     i.now().Add(i.ttl),
+		})
+	}
+}
+
+// idempotencyStoreKey combines the Idempotency-Key with the vary headers
+func idempotencyStoreKey(r *http.Request, idempotencyKey string, varyHeaders []string) string {
+	hash := sha256.New()
+	for _, name := range varyHeaders {
+		for _, value := range r.Header[http.CanonicalHeaderKey(name)] {
+			fmt.Fprintf(hash, "%d:%s%d:%s", len(name), name, len(value), value)
+		}
+	}
+	return idempotencyKey + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyFingerprint identifies a request by its procedure, method, path, params and body
+func idempotencyFingerprint(req *httpapi.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(requestKey(&http.Request{}, req, nil)))
+	hash.Write([]byte(strconv.Itoa(int(req.GetMethod()))))
+	hash.Write(req.GetPayload())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore which removes expired records as it goes
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemoryIdempotencyStore creates an in-memory IdempotencyStore
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{
+		records: map[string]*IdempotencyRecord{},
+		now:     time.Now,
+	}
+}
+
+func (s *memoryIdempotencyStore) Reserve(key string, record *IdempotencyRecord) (*IdempotencyRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.swept) > time.Minute {
+		for existingKey, existing := range s.records {
+			if !now.Before(existing.Expires) {
+				delete(s.records, existingKey)
+			}
+		}
+		s.swept = now
+	}
+	if existing, found := s.records[key]; found && now.Before(existing.Expires) {
+		return existing, false
+	}
+	s.records[key] = record
+	return nil, true
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, record *IdempotencyRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+}
+
+func (s *memoryIdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+}
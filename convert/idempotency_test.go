@@ -0,0 +1,114 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestProxy_SetIdempotency(t *testing.T) {
+	release := make(chan struct{})
+	conn := &fakeConn{respond: func(req *httpapi.Request) (*httpapi.Response, error) {
+		switch string(req.GetPayload()) {
+		case "slow":
+			<-release
+		case "unavailable":
+			return nil, status.Error(codes.Unavailable, "try again")
+		}
+		return &httpapi.Response{StatusCode: http.StatusOK, Payload: []byte(`{"id":"` + string(req.GetPayload()) + `"}`)}, nil
+	}}
+	p := NewProxy()
+	p.SetIdempotency(&IdempotencyConfig{VaryHeaders: []string{"Authorization"}})
+	send := func(key, user, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/UploadPhoto", strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", key)
+		r.Header.Set("Authorization", user)
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "UploadPhoto", conn, "")
+		return w
+	}
+	t.Run("replay", func(t *testing.T) {
+		conn.requests = nil
+		first := send("a", "alice", "photo")
+		assert.Equal(t, http.StatusOK, first.Code)
+		second := send("a", "alice", "photo")
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+		assert.Len(t, conn.requests, 1)
+		assert.Equal(t, http.StatusOK, send("a", "bob", "photo").Code)
+		assert.Len(t, conn.requests, 2)
+	})
+	t.Run("mismatch", func(t *testing.T) {
+		send("b", "alice", "photo")
+		w := send("b", "alice", "other")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonIdempotencyMismatch)
+	})
+	t.Run("path mismatch", func(t *testing.T) {
+		for i, path := range []string{"/v1/photos/1", "/v1/photos/2"} {
+			r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("photo"))
+			r.Header.Set("Idempotency-Key", "f")
+			r.Header.Set("Authorization", "alice")
+			w := httptest.NewRecorder()
+			p.ProxyRequest(context.Background(), w, r, "UploadPhoto", conn, "")
+			if i == 0 {
+				assert.Equal(t, http.StatusOK, w.Code)
+			} else {
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			}
+		}
+	})
+	t.Run("in flight", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- send("c", "alice", "slow") }()
+		var w *httptest.ResponseRecorder
+		assert.Eventually(t, func() bool {
+			w = send("c", "alice", "slow")
+			return w.Code == http.StatusConflict
+		}, time.Second, time.Millisecond)
+		assert.Contains(t, w.Body.String(), ReasonIdempotencyConflict)
+		close(release)
+		assert.Equal(t, http.StatusOK, (<-done).Code)
+		assert.Equal(t, "true", send("c", "alice", "slow").Header().Get(IdempotentReplayedHeader))
+	})
+	t.Run("server errors aren't stored", func(t *testing.T) {
+		conn.requests = nil
+		assert.Equal(t, http.StatusServiceUnavailable, send("d", "alice", "unavailable").Code)
+		assert.Equal(t, http.StatusServiceUnavailable, send("d", "alice", "unavailable").Code)
+		assert.Len(t, conn.requests, 2)
+	})
+	t.Run("safe methods are ignored", func(t *testing.T) {
+		conn.requests = nil
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest(http.MethodGet, "/Photo", nil)
+			r.Header.Set("Idempotency-Key", "e")
+			p.ProxyRequest(context.Background(), httptest.NewRecorder(), r, "Photo", conn, "")
+		}
+		assert.Len(t, conn.requests, 2)
+	})
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryIdempotencyStore().(*memoryIdempotencyStore)
+	store.now = func() time.Time { return now }
+	_, reserved := store.Reserve("key", &IdempotencyRecord{Fingerprint: "first", Expires: now.Add(time.Hour)})
+	assert.True(t, reserved)
+	existing, reserved := store.Reserve("key", &IdempotencyRecord{Fingerprint: "second", Expires: now.Add(time.Hour)})
+	assert.False(t, reserved)
+	assert.Equal(t, "first", existing.Fingerprint)
+	now = now.Add(2 * time.Hour)
+	_, reserved = store.Reserve("key", &IdempotencyRecord{Fingerprint: "third", Expires: now.Add(time.Hour)})
+	assert.True(t, reserved)
+	store.Release("key")
+	assert.Empty(t, store.records)
+}
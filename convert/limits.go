@@ -0,0 +1,115 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LLKennedy/mercury/internal/limit"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// ReasonOverloaded is the ErrorInfo reason given when a request is rejected by a concurrency limit
+	ReasonOverloaded = "OVERLOADED"
+)
+
+// ConcurrencyLimits configures the maximum number of concurrent unary requests and open websocket streams the proxy allows
+type ConcurrencyLimits struct {
+	// PerProcedure caps concurrent requests to each procedure, zero is unlimited. Individual procedures may be overridden with SetProcedureConcurrencyLimit
+	PerProcedure int
+	// PerBackend caps concurrent requests to each backend, zero is unlimited. Individual backends may be overridden with SetBackendConcurrencyLimit
+	PerBackend int
+	// QueueTimeout is how long a request may wait for a free slot before being rejected, zero rejects excess requests immediately
+	QueueTimeout time.Duration
+	// RetryAfter is sent to rejected clients as a Retry-After header, defaults to 1 second
+	RetryAfter time.Duration
+}
+
+type proxyLimits struct {
+	procedures *limit.Group
+	backends   *limit.Group
+	mu         sync.Mutex
+	wait       time.Duration
+	retryAfter time.Duration
+}
+
+// SetConcurrencyLimits enables or adjusts concurrency limits, it is safe to call again while serving requests
+func (p *Proxy) SetConcurrencyLimits(limits ConcurrencyLimits) {
+	l := p.initLimits()
+	l.procedures.SetDefault(limits.PerProcedure)
+	l.backends.SetDefault(limits.PerBackend)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.wait = limits.QueueTimeout
+	l.retryAfter = limits.RetryAfter
+	if l.retryAfter <= 0 {
+		l.retryAfter = time.Second
+	}
+}
+
+// SetProcedureConcurrencyLimit overrides the concurrency limit for a single procedure, zero is unlimited
+func (p *Proxy) SetProcedureConcurrencyLimit(procedure string, max int) {
+	p.initLimits().procedures.Set(procedure, max)
+}
+
+// SetBackendConcurrencyLimit overrides the concurrency limit for a single backend, as identified by the BackendKeyFunc, zero is unlimited
+func (p *Proxy) SetBackendConcurrencyLimit(backend string, max int) {
+	p.initLimits().backends.Set(backend, max)
+}
+
+// initLimits creates the limits on first use, requests already in flight go on without them
+func (p *Proxy) initLimits() *proxyLimits {
+	p.limitsOnce.Do(func() {
+		p.limits.Store(&proxyLimits{
+			procedures: limit.NewGroup(0),
+			backends:   limit.NewGroup(0),
+			retryAfter: time.Second,
+		})
+	})
+	return p.getLimits()
+}
+
+func (p *Proxy) getLimits() *proxyLimits {
+	if p == nil {
+		p = defaultProxy
+	}
+	l, _ := p.limits.Load().(*proxyLimits)
+	return l
+}
+
+// acquireSlots writes a 503 to w and returns ok = false if the procedure or backend is at capacity, otherwise it returns a function to release the slots
+func (p *Proxy) acquireSlots(ctx context.Context, w http.ResponseWriter, procedure, backend string, txid string, loggers []logs.Writer) (release func(), ok bool) {
+	l := p.getLimits()
+	if l == nil {
+		return func() {}, true
+	}
+	l.mu.Lock()
+	wait, retryAfter := l.wait, l.retryAfter
+	l.mu.Unlock()
+	deadline := time.Now().Add(wait)
+	if !l.procedures.Acquire(ctx, procedure, wait) {
+		p.shed(w, "procedure", procedure, procedure, retryAfter, txid, loggers)
+		return nil, false
+	}
+	if !l.backends.Acquire(ctx, backend, time.Until(deadline)) {
+		l.procedures.Release(procedure)
+		p.shed(w, "backend", backend, procedure, retryAfter, txid, loggers)
+		return nil, false
+	}
+	return func() {
+		l.backends.Release(backend)
+		l.procedures.Release(procedure)
+	}, true
+}
+
+func (p *Proxy) shed(w http.ResponseWriter, limitType, key, procedure string, retryAfter time.Duration, txid string, loggers []logs.Writer) {
+	for _, logger := range loggers {
+		logger.LogWarningf(txid, "mercury: rejecting request to %s, %s %s is at its concurrency limit", procedure, limitType, key)
+	}
+	p.count("mercury_requests_shed", map[string]string{"limit": limitType, "key": key, "procedure": procedure})
+	writeStatusError(w, http.StatusServiceUnavailable, codes.Unavailable, ReasonOverloaded, fmt.Sprintf("mercury: %s %s is at its concurrency limit", limitType, key), retryAfter)
+}
@@ -0,0 +1,212 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/limit"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxLoggedDiffs limits how many differences are logged for a single mirrored request
+const maxLoggedDiffs = 20
+
+// MirrorConfig configures asynchronous duplication of unary requests to a shadow backend
+type MirrorConfig struct {
+	// Conn is the shadow backend, nil disables mirroring
+	Conn grpc.ClientConnInterface
+	// Percent is the share of unary requests duplicated to the shadow backend, from 0 to 100
+	Percent float64
+	// LogDiff logs any differences between the primary and shadow responses through the loggers passed to ProxyRequest
+	LogDiff bool
+	// Timeout bounds each shadow call, defaults to 10 seconds
+	Timeout time.Duration
+	// MaxInFlight caps concurrent shadow calls, requests which would exceed it are not mirrored. Defaults to 100
+	MaxInFlight int
+	// Unsafe also mirrors requests with methods other than GET, HEAD and OPTIONS, which repeats their side effects on the shadow backend
+	Unsafe bool
+}
+
+type mirror struct {
+	config   MirrorConfig
+	remote   httpapi.ExposedServiceClient
+	inFlight *limit.Limiter
+}
+
+// mirrorResult is the outcome of the primary call, handed to the shadow call for comparison
+type mirrorResult struct {
+	res *httpapi.Response
+	err error
+}
+
+// SetMirror enables or disables mirroring of unary requests to a shadow backend. Shadow responses are discarded and never delay or affect the primary response
+func (p *Proxy) SetMirror(config MirrorConfig) {
+	if config.Conn == nil || config.Percent <= 0 {
+		p.mirror = nil
+		return
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 100
+	}
+	p.mirror = &mirror{
+		config:   config,
+		remote:   httpapi.NewExposedServiceClient(config.Conn),
+		inFlight: limit.New(config.MaxInFlight),
+	}
+}
+
+func (p *Proxy) getMirror() *mirror {
+	if p == nil {
+		return defaultProxy.mirror
+	}
+	return p.mirror
+}
+
+// isSafeMethod is true for methods which shouldn't change anything, so they can be repeated on a shadow backend
+func isSafeMethod(method httpapi.Method) bool {
+	return method == httpapi.Method_GET || method == httpapi.Method_HEAD || method == httpapi.Method_OPTIONS
+}
+
+// mirrorUnary starts a shadow call for a sampled share of requests, returning a function to hand over the primary result once it is known.
+// The shadow call gets a copy of the outgoing metadata of ctx, but not its deadline or cancellation, as it may outlive the primary call
+func (p *Proxy) mirrorUnary(ctx context.Context, req *httpapi.Request, txid string, loggers []logs.Writer) (primaryDone func(res *httpapi.Response, err error)) {
+	m := p.getMirror()
+	if m == nil || !m.config.Unsafe && !isSafeMethod(req.GetMethod()) || rand.Float64()*100 >= m.config.Percent {
+		return func(*httpapi.Response, error) {}
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	shadowCtx := metadata.NewOutgoingContext(context.Background(), md.Copy())
+	if !m.inFlight.Acquire(context.Background(), 0) {
+		p.count("mercury_mirror_dropped", map[string]string{"procedure": req.GetProcedure()})
+		return func(*httpapi.Response, error) {}
+	}
+	primary := make(chan mirrorResult, 1)
+	go func() {
+		defer m.inFlight.Release()
+		defer func() {
+			if r := recover(); r != nil {
+				for _, logger := range loggers {
+					logger.LogErrorf(txid, "mercury: caught panic mirroring request: %v", r)
+				}
+			}
+		}()
+		ctx, cancel := context.WithTimeout(shadowCtx, m.config.Timeout)
+		defer cancel()
+		p.count("mercury_mirror_requests", map[string]string{"procedure": req.GetProcedure()})
+		shadowRes, shadowErr := m.remote.ProxyUnary(ctx, req)
+		if shadowErr != nil {
+			for _, logger := range loggers {
+				logger.LogTracef(txid, "mercury: shadow backend returned error for %s: %v", req.GetProcedure(), shadowErr)
+			}
+		}
+		if !m.config.LogDiff {
+			return
+		}
+		var result mirrorResult
+		select {
+		case result = <-primary:
+		case <-ctx.Done():
+			return
+		}
+		diffs := diffResponses(result.res, result.err, shadowRes, shadowErr)
+		if len(diffs) == 0 {
+			return
+		}
+		p.count("mercury_mirror_mismatches", map[string]string{"procedure": req.GetProcedure()})
+		for _, logger := range loggers {
+			logger.LogWarningf(txid, "mercury: shadow response for %s differs from primary: %s", req.GetProcedure(), strings.Join(diffs, "; "))
+		}
+	}()
+	return func(res *httpapi.Response, err error) {
+		primary <- mirrorResult{res: res, err: err}
+	}
+}
+
+// diffResponses describes the differences between two unary results
+func diffResponses(primary *httpapi.Response, primaryErr error, shadow *httpapi.Response, shadowErr error) []string {
+	if primaryErr != nil || shadowErr != nil {
+		primaryStatus, shadowStatus := status.Convert(primaryErr), status.Convert(shadowErr)
+		if primaryStatus.Code() != shadowStatus.Code() {
+			return []string{fmt.Sprintf("status: primary=%s shadow=%s", primaryStatus.Code(), shadowStatus.Code())}
+		}
+		return nil
+	}
+	diffs := []string{}
+	if primary.GetStatusCode() != shadow.GetStatusCode() {
+		diffs = append(diffs, fmt.Sprintf("status code: primary=%d shadow=%d", primary.GetStatusCode(), shadow.GetStatusCode()))
+	}
+	if bytes.Equal(primary.GetPayload(), shadow.GetPayload()) {
+		return diffs
+	}
+	var primaryJSON, shadowJSON interface{}
+	primaryParseErr := json.Unmarshal(primary.GetPayload(), &primaryJSON)
+	shadowParseErr := json.Unmarshal(shadow.GetPayload(), &shadowJSON)
+	if primaryParseErr != nil || shadowParseErr != nil {
+		return append(diffs, "payload: primary and shadow payloads differ and are not both valid JSON")
+	}
+	diffJSON("", primaryJSON, shadowJSON, &diffs)
+	return diffs
+}
+
+// diffJSON appends the paths at which two decoded JSON values differ to diffs
+func diffJSON(path string, primary, shadow interface{}, diffs *[]string) {
+	if len(*diffs) >= maxLoggedDiffs {
+		return
+	}
+	describe := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	primaryMap, primaryIsMap := primary.(map[string]interface{})
+	shadowMap, shadowIsMap := shadow.(map[string]interface{})
+	if primaryIsMap && shadowIsMap {
+		keys := map[string]struct{}{}
+		for key := range primaryMap {
+			keys[key] = struct{}{}
+		}
+		for key := range shadowMap {
+			keys[key] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			diffJSON(childPath, primaryMap[key], shadowMap[key], diffs)
+		}
+		return
+	}
+	primaryList, primaryIsList := primary.([]interface{})
+	shadowList, shadowIsList := shadow.([]interface{})
+	if primaryIsList && shadowIsList && len(primaryList) == len(shadowList) {
+		for i := range primaryList {
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), primaryList[i], shadowList[i], diffs)
+		}
+		return
+	}
+	if !reflect.DeepEqual(primary, shadow) {
+		if path == "" {
+			path = "payload"
+		}
+		*diffs = append(*diffs, fmt.Sprintf("%s: primary=%s shadow=%s", path, describe(primary), describe(shadow)))
+	}
+}
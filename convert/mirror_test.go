@@ -0,0 +1,122 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// shadowCall is what a shadowConn saw when it was released
+type shadowCall struct {
+	md  metadata.MD
+	err error
+}
+
+// shadowConn holds each ProxyUnary call until release is closed, then reports its metadata and context error to calls
+type shadowConn struct {
+	fakeStreamConn
+	release chan struct{}
+	calls   chan shadowCall
+}
+
+func (s *shadowConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	<-s.release
+	md, _ := metadata.FromOutgoingContext(ctx)
+	s.calls <- shadowCall{md: md, err: ctx.Err()}
+	return nil
+}
+
+func TestProxy_mirrorUnary(t *testing.T) {
+	newProxy := func(unsafe bool) (*Proxy, *shadowConn) {
+		shadow := &shadowConn{release: make(chan struct{}), calls: make(chan shadowCall, 1)}
+		p := NewProxy()
+		p.SetMirror(MirrorConfig{Conn: shadow, Percent: 100, Unsafe: unsafe})
+		return p, shadow
+	}
+	t.Run("detached from the primary call", func(t *testing.T) {
+		p, shadow := newProxy(false)
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/Photo", nil)
+		r.Header.Set("If-None-Match", `"v1"`)
+		p.ProxyRequest(ctx, httptest.NewRecorder(), r, "GetPhoto", &etagConn{}, "tx-1")
+		cancel()
+		close(shadow.release)
+		call := <-shadow.calls
+		assert.NoError(t, call.err)
+		assert.Equal(t, []string{"tx-1"}, call.md.Get(TxidMetadata))
+		assert.Equal(t, []string{`"v1"`}, call.md.Get("if-none-match"))
+	})
+	t.Run("safe methods only", func(t *testing.T) {
+		p, shadow := newProxy(false)
+		defer close(shadow.release)
+		p.ProxyRequest(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/Photo", strings.NewReader("{}")), "PostPhoto", &etagConn{}, "")
+		assert.Equal(t, 0, p.getMirror().inFlight.InUse())
+	})
+	t.Run("unsafe methods when enabled", func(t *testing.T) {
+		p, shadow := newProxy(true)
+		p.ProxyRequest(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/Photo", strings.NewReader("{}")), "PostPhoto", &etagConn{}, "")
+		assert.Equal(t, 1, p.getMirror().inFlight.InUse())
+		close(shadow.release)
+		<-shadow.calls
+	})
+}
+
+func Test_diffResponses(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   *httpapi.Response
+		primErr   error
+		shadow    *httpapi.Response
+		shadowErr error
+		want      []string
+	}{
+		{
+			name:    "identical",
+			primary: &httpapi.Response{StatusCode: 200, Payload: []byte(`{"a":1}`)},
+			shadow:  &httpapi.Response{StatusCode: 200, Payload: []byte(`{"a":1}`)},
+			want:    []string{},
+		},
+		{
+			name:    "reordered keys are equal",
+			primary: &httpapi.Response{StatusCode: 200, Payload: []byte(`{"a":1,"b":2}`)},
+			shadow:  &httpapi.Response{StatusCode: 200, Payload: []byte(`{"b":2,"a":1}`)},
+			want:    []string{},
+		},
+		{
+			name:    "nested differences",
+			primary: &httpapi.Response{StatusCode: 200, Payload: []byte(`{"a":{"b":[1,2]},"c":"x"}`)},
+			shadow:  &httpapi.Response{StatusCode: 201, Payload: []byte(`{"a":{"b":[1,3]},"d":"x"}`)},
+			want: []string{
+				"status code: primary=200 shadow=201",
+				"a.b[1]: primary=2 shadow=3",
+				`c: primary="x" shadow=null`,
+				`d: primary=null shadow="x"`,
+			},
+		},
+		{
+			name:      "different errors",
+			primary:   &httpapi.Response{StatusCode: 200},
+			shadowErr: status.Error(codes.Unavailable, "down"),
+			want:      []string{"status: primary=OK shadow=Unavailable"},
+		},
+		{
+			name:      "same errors",
+			primErr:   status.Error(codes.NotFound, "missing"),
+			shadowErr: status.Error(codes.NotFound, "gone"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffResponses(tt.primary, tt.primErr, tt.shadow, tt.shadowErr))
+		})
+	}
+}
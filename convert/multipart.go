@@ -0,0 +1,148 @@
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// ReasonBodyTooLarge is the ErrorInfo reason given when a request body is larger than the configured maximum
+	ReasonBodyTooLarge = "BODY_TOO_LARGE"
+	// ReasonInvalidForm is the ErrorInfo reason given when a form request body can't be parsed
+	ReasonInvalidForm = "INVALID_FORM"
+)
+
+// errBodyTooLarge is returned by a sizeLimitedReader once more than its limit has been read
+var errBodyTooLarge = errors.New("mercury: request body too large")
+
+// MultipartConfig configures how multipart/form-data request bodies are read
+type MultipartConfig struct {
+	// MaxSize is the largest multipart body accepted, defaults to 3MiB which leaves room for the rest of the request within gRPC's default 4MiB message limit
+	MaxSize int64
+	// MaxMemory is how much of the body's file parts is held in memory while it's read, the rest is written to temporary files. Defaults to 1MiB
+	MaxMemory int64
+}
+
+// SetMultipartConfig configures the limits for multipart/form-data request bodies
+func (p *Proxy) SetMultipartConfig(config MultipartConfig) {
+	p.multipart = config
+}
+
+func (p *Proxy) getMultipartConfig() MultipartConfig {
+	config := defaultProxy.multipart
+	if p != nil {
+		config = p.multipart
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = 3 << 20
+	}
+	if config.MaxMemory <= 0 {
+		config.MaxMemory = 1 << 20
+	}
+	return config
+}
+
+// isMultipart is true for requests with a multipart/form-data body
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// readMultipart checks a multipart/form-data body and sets the payload to it, which the backend decodes with file parts filling bytes fields as they are.
+// File parts beyond MaxMemory are held in temporary files while the body is read, and the form is written back out once it's complete.
+// It writes an error to w and returns false if the body is too large or can't be parsed
+func (p *Proxy) readMultipart(w http.ResponseWriter, r *http.Request, req *httpapi.Request, txid string, loggers []logs.Writer) bool {
+	config := p.getMultipartConfig()
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := &sizeLimitedReader{r: r.Body, remaining: config.MaxSize}
+	form, err := multipart.NewReader(body, params["boundary"]).ReadForm(config.MaxMemory)
+	if body.remaining < 0 {
+		// The rest of the body is left unread, so the connection can't be reused
+		w.Header().Set("Connection", "close")
+		writeStatusError(w, http.StatusRequestEntityTooLarge, codes.ResourceExhausted, ReasonBodyTooLarge, fmt.Sprintf("mercury: multipart body is larger than %d bytes", config.MaxSize), 0)
+		return false
+	}
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, codes.InvalidArgument, ReasonInvalidForm, fmt.Sprintf("mercury: invalid multipart body: %v", err), 0)
+		return false
+	}
+	defer func() {
+		if err := form.RemoveAll(); err != nil {
+			for _, logger := range loggers {
+				logger.LogErrorf(txid, "mercury: failed to remove multipart temporary files: %v", err)
+			}
+		}
+	}()
+	payload := &bytes.Buffer{}
+	out := multipart.NewWriter(payload)
+	for name, values := range form.Value {
+		for _, value := range values {
+			if err == nil {
+				err = out.WriteField(name, value)
+			}
+		}
+	}
+	for _, files := range form.File {
+		for _, header := range files {
+			if err == nil {
+				err = writePart(out, header)
+			}
+		}
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		writeStatusError(w, http.StatusInternalServerError, codes.Internal, ReasonInvalidForm, fmt.Sprintf("mercury: failed to forward multipart body: %v", err), 0)
+		return false
+	}
+	req.Headers["Content-Type"] = &httpapi.MultiVal{Values: []string{out.FormDataContentType()}}
+	req.Payload = payload.Bytes()
+	return true
+}
+
+// writePart copies a file part, which may be held in a temporary file, to out with its original headers
+func writePart(out *multipart.Writer, header *multipart.FileHeader) error {
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	part, err := out.CreatePart(header.Header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+// sizeLimitedReader reads from r until more than remaining bytes have been read, then returns errBodyTooLarge
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		// One byte more than the limit is enough to know the body is too large
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
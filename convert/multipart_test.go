@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy_readMultipart(t *testing.T) {
+	conn := &fakeConn{respond: func(req *httpapi.Request) (*httpapi.Response, error) {
+		return &httpapi.Response{StatusCode: http.StatusOK}, nil
+	}}
+	p := NewProxy()
+	p.SetMultipartConfig(MultipartConfig{MaxSize: 1024})
+	upload := func(build func(form *multipart.Writer)) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		build(form)
+		form.Close()
+		r := httptest.NewRequest(http.MethodPost, "/UploadPhoto?album=1", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "UploadPhoto", conn, "")
+		return w
+	}
+	// forwarded decodes the multipart body conn received, by part name
+	forwarded := func(req *httpapi.Request) map[string]string {
+		_, params, err := mime.ParseMediaType(req.GetHeaders()["Content-Type"].GetValues()[0])
+		assert.NoError(t, err)
+		parts := map[string]string{}
+		reader := multipart.NewReader(bytes.NewReader(req.GetPayload()), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				assert.Equal(t, io.EOF, err)
+				return parts
+			}
+			data, _ := ioutil.ReadAll(part)
+			parts[part.FormName()] = part.FileName() + ":" + string(data)
+		}
+	}
+	t.Run("forwarded body", func(t *testing.T) {
+		conn.requests = nil
+		w := upload(func(form *multipart.Writer) {
+			form.WriteField("title", "cat")
+			file, _ := form.CreateFormFile("data", "cat.jpg")
+			file.Write([]byte("not really a jpeg"))
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+		if assert.Len(t, conn.requests, 1) {
+			assert.Equal(t, map[string]string{"title": ":cat", "data": "cat.jpg:not really a jpeg"}, forwarded(conn.requests[0]))
+			assert.Equal(t, []string{"1"}, conn.requests[0].GetParams()["album"].GetValues())
+		}
+	})
+	t.Run("large parts spill to temporary files", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "multipart")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		tmp := os.Getenv("TMPDIR")
+		os.Setenv("TMPDIR", dir)
+		defer os.Setenv("TMPDIR", tmp)
+		p.SetMultipartConfig(MultipartConfig{MaxSize: 1024, MaxMemory: 16})
+		defer p.SetMultipartConfig(MultipartConfig{MaxSize: 1024})
+		conn.requests = nil
+		big := strings.Repeat("x", 512)
+		w := upload(func(form *multipart.Writer) {
+			file, _ := form.CreateFormFile("data", "big.jpg")
+			file.Write([]byte(big))
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+		if assert.Len(t, conn.requests, 1) {
+			assert.Equal(t, map[string]string{"data": "big.jpg:" + big}, forwarded(conn.requests[0]))
+		}
+		left, _ := ioutil.ReadDir(dir)
+		assert.Empty(t, left, "temporary files should be removed")
+	})
+	t.Run("malformed", func(t *testing.T) {
+		conn.requests = nil
+		r := httptest.NewRequest(http.MethodPost, "/UploadPhoto", strings.NewReader("garbage"))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "UploadPhoto", conn, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonInvalidForm)
+		assert.Empty(t, conn.requests)
+	})
+	t.Run("too large", func(t *testing.T) {
+		conn.requests = nil
+		w := upload(func(form *multipart.Writer) {
+			file, _ := form.CreateFormFile("data", "big.jpg")
+			file.Write(make([]byte, 2048))
+		})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonBodyTooLarge)
+		assert.Equal(t, "close", w.Header().Get("Connection"))
+		assert.Empty(t, conn.requests)
+	})
+	t.Run("default limit fits a gRPC message", func(t *testing.T) {
+		assert.True(t, NewProxy().getMultipartConfig().MaxSize < 4<<20)
+	})
+}
+
+func TestSizeLimitedReader(t *testing.T) {
+	read := func(size int, limit int64) ([]byte, error) {
+		var out []byte
+		buffer := make([]byte, 3)
+		reader := &sizeLimitedReader{r: bytes.NewReader(make([]byte, size)), remaining: limit}
+		for {
+			n, err := reader.Read(buffer)
+			out = append(out, buffer[:n]...)
+			if err != nil {
+				return out, err
+			}
+		}
+	}
+	data, err := read(10, 10)
+	assert.Len(t, data, 10)
+	assert.Equal(t, io.EOF, err)
+	data, err = read(11, 10)
+	assert.Len(t, data, 11)
+	assert.Equal(t, errBodyTooLarge, err)
+}
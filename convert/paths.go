@@ -0,0 +1,108 @@
+package convert
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// PathHeader is the request header mercury uses to forward the escaped URL path to the backend, so it can fill in variables from google.api.http path templates.
+	// Any value sent by the client is replaced
+	PathHeader = "X-Mercury-Path"
+	// ReasonRouteNotFound is the ErrorInfo reason given when no path template matches a request
+	ReasonRouteNotFound = "ROUTE_NOT_FOUND"
+)
+
+// PathMatcher finds the procedure for a request from the google.api.http options on an exposed service's methods, e.g. get: "/v1/photos/{photo_id}"
+// Paths are matched exactly as the request arrives, use http.StripPrefix if the proxy is mounted under a prefix
+type PathMatcher struct {
+	mu     sync.RWMutex
+	routes []pathRoute
+}
+
+type pathRoute struct {
+	procedure string
+	binding   httprule.Binding
+}
+
+// NewPathMatcher creates a PathMatcher with no routes
+func NewPathMatcher() *PathMatcher {
+	return &PathMatcher{}
+}
+
+// AddService adds a route for every binding of every method on service which has a google.api.http option.
+// Method names must start with the HTTP method they are bound to, as they do for proxy.NewServer, e.g. GetPhoto with get: "/v1/photos/{photo_id}"
+func (m *PathMatcher) AddService(service protoreflect.ServiceDescriptor) error {
+	routes := []pathRoute{}
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		bindings, err := httprule.Bindings(method)
+		if err != nil {
+			return fmt.Errorf("mercury: %v", err)
+		}
+		for _, binding := range bindings {
+			procedure, ok := httprule.Procedure(string(method.Name()), binding.Method)
+			if !ok {
+				return fmt.Errorf("mercury: %s is bound to %s but does not begin with that HTTP method", method.FullName(), binding.Method)
+			}
+			routes = append(routes, pathRoute{procedure: procedure, binding: binding})
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = append(m.routes, routes...)
+	return nil
+}
+
+// Match returns the procedure for the first route matching the request's method and path
+func (m *PathMatcher) Match(r *http.Request) (procedure string, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	method := strings.ToUpper(r.Method)
+	if r.Header.Get("Upgrade") == "websocket" {
+		// Websockets always open with a GET, so match streams on their path alone
+		method = ""
+	}
+	path := r.URL.EscapedPath()
+	for _, route := range m.routes {
+		if method != "" && route.binding.Method != method {
+			continue
+		}
+		if _, matched := route.binding.Template.Match(path); matched {
+			return route.procedure, true
+		}
+	}
+	return "", false
+}
+
+// SetPathMatcher sets the PathMatcher used to find the procedure when ProxyRequest is called with an empty procedure, nil disables matching
+func (p *Proxy) SetPathMatcher(matcher *PathMatcher) {
+	p.paths = matcher
+}
+
+func (p *Proxy) getPathMatcher() *PathMatcher {
+	if p == nil {
+		return defaultProxy.paths
+	}
+	return p.paths
+}
+
+// matchProcedure returns procedure if it was set, otherwise it looks it up with the PathMatcher, writing a 404 if it doesn't match
+func (p *Proxy) matchProcedure(w http.ResponseWriter, r *http.Request, procedure string) (string, bool) {
+	matcher := p.getPathMatcher()
+	if procedure != "" || matcher == nil {
+		return procedure, true
+	}
+	if procedure, ok := matcher.Match(r); ok {
+		return procedure, true
+	}
+	writeStatusError(w, http.StatusNotFound, codes.NotFound, ReasonRouteNotFound, fmt.Sprintf("mercury: no procedure matches %s %s", r.Method, r.URL.Path), 0)
+	return "", false
+}
@@ -0,0 +1,61 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestPathMatcher(t *testing.T) {
+	newMethod := func(name string, rule *annotations.HttpRule) *descriptorpb.MethodDescriptorProto {
+		options := &descriptorpb.MethodOptions{}
+		proto.SetExtension(options, annotations.E_Http, rule)
+		return &descriptorpb.MethodDescriptorProto{Name: proto.String(name), InputType: proto.String(".photos.Photo"), OutputType: proto.String(".photos.Photo"), Options: options}
+	}
+	newFile := func(methods ...*descriptorpb.MethodDescriptorProto) *descriptorpb.FileDescriptorProto {
+		return &descriptorpb.FileDescriptorProto{
+			Name:        proto.String("photos.proto"),
+			Package:     proto.String("photos"),
+			Syntax:      proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Photo")}},
+			Service:     []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Photos"), Method: methods}},
+		}
+	}
+	file, err := protodesc.NewFile(newFile(
+		newMethod("GetPhoto", &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/photos/{photo_id}"}}),
+		newMethod("PostPhoto", &annotations.HttpRule{Pattern: &annotations.HttpRule_Post{Post: "/v1/photos"}, Body: "*"}),
+	), nil)
+	assert.NoError(t, err)
+	matcher := NewPathMatcher()
+	assert.NoError(t, matcher.AddService(file.Services().Get(0)))
+	procedure, ok := matcher.Match(httptest.NewRequest(http.MethodGet, "/v1/photos/1", nil))
+	assert.True(t, ok)
+	assert.Equal(t, "Photo", procedure)
+	procedure, ok = matcher.Match(httptest.NewRequest(http.MethodPost, "/v1/photos", nil))
+	assert.True(t, ok)
+	assert.Equal(t, "Photo", procedure)
+	_, ok = matcher.Match(httptest.NewRequest(http.MethodPost, "/v1/photos/1", nil))
+	assert.False(t, ok)
+	t.Run("unmatched request", func(t *testing.T) {
+		p := NewProxy()
+		p.SetPathMatcher(matcher)
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, httptest.NewRequest(http.MethodGet, "/v2/photos", nil), "", nil, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonRouteNotFound)
+	})
+	t.Run("mismatched method name", func(t *testing.T) {
+		file, err := protodesc.NewFile(newFile(
+			newMethod("GetPhoto", &annotations.HttpRule{Pattern: &annotations.HttpRule_Delete{Delete: "/v1/photos/{photo_id}"}}),
+		), nil)
+		assert.NoError(t, err)
+		assert.Error(t, NewPathMatcher().AddService(file.Services().Get(0)))
+	})
+}
@@ -0,0 +1,144 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/LLKennedy/mercury/internal/drain"
+	"github.com/LLKennedy/mercury/logs"
+	"github.com/LLKennedy/mercury/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Proxy converts HTTP(S) and WS(S) requests into calls on GRPC connections compliant with mercury/httpapi
+// The zero value proxies every request directly with no additional behaviour, use the setters to configure anything further
+type Proxy struct {
+	backendKey  BackendKeyFunc
+	breakers    *breakerSet
+	limits      atomic.Value // *proxyLimits
+	limitsOnce  sync.Once
+	mirror      *mirror
+	router      *Router
+	cache       *responseCache
+	idempotency *idempotency
+	coalescer   *coalescer
+	paths       *PathMatcher
+	batch       BatchConfig
+	multipart   MultipartConfig
+	downloads   map[string]bool
+	uploads     map[string]bool
+	metrics     []metrics.Recorder
+	drain       drain.Drainer
+}
+
+// We use defaultProxy in the case that p is nil
+var defaultProxy = &Proxy{}
+
+// NewProxy creates a new Proxy with no optional behaviour enabled
+func NewProxy() *Proxy {
+	return &Proxy{}
+}
+
+// SetBackendKeyFunc sets how the proxy identifies backends, e.g. by service name rather than connection. The default is DefaultBackendKey
+func (p *Proxy) SetBackendKeyFunc(keyFunc BackendKeyFunc) {
+	p.backendKey = keyFunc
+}
+
+// SetCircuitBreaker enables a circuit breaker per backend, failing fast with 503 Service Unavailable while a backend's breaker is open
+// Calling SetCircuitBreaker again replaces all existing breakers, resetting their state
+func (p *Proxy) SetCircuitBreaker(config BreakerConfig) {
+	p.breakers = newBreakerSet(config)
+}
+
+// CircuitBreakerState returns the current state of the circuit breaker for key, or BreakerClosed if there is no such breaker
+func (p *Proxy) CircuitBreakerState(key string) BreakerState {
+	breakers := p.getBreakers()
+	if breakers == nil {
+		return BreakerClosed
+	}
+	return breakers.get(key).getState()
+}
+
+// SetMetrics sets the recorders which receive metrics from the proxy
+func (p *Proxy) SetMetrics(recorders ...metrics.Recorder) {
+	p.metrics = recorders
+}
+
+func (p *Proxy) getBackendKey(procedure string, conn grpc.ClientConnInterface) string {
+	keyFunc := defaultProxy.backendKey
+	if p != nil {
+		keyFunc = p.backendKey
+	}
+	if keyFunc == nil {
+		keyFunc = DefaultBackendKey
+	}
+	return keyFunc(procedure, conn)
+}
+
+func (p *Proxy) getBreakers() *breakerSet {
+	if p == nil {
+		return defaultProxy.breakers
+	}
+	return p.breakers
+}
+
+func (p *Proxy) getMetrics() []metrics.Recorder {
+	if p == nil {
+		return defaultProxy.metrics
+	}
+	return p.metrics
+}
+
+// checkBreaker writes a 503 to w and returns ok = false if the breaker for the backend is open, otherwise it returns a function to record the result of the call
+func (p *Proxy) checkBreaker(w http.ResponseWriter, procedure, key string, txid string, loggers []logs.Writer) (record func(err error), ok bool) {
+	breakers := p.getBreakers()
+	if breakers == nil {
+		return func(error) {}, true
+	}
+	b := breakers.get(key)
+	allowed, retryAfter, transition := b.allow()
+	p.reportBreakerTransition(key, transition, txid, loggers)
+	if !allowed {
+		p.count("mercury_breaker_rejected", map[string]string{"breaker": key, "procedure": procedure})
+		writeStatusError(w, http.StatusServiceUnavailable, codes.Unavailable, ReasonCircuitOpen, fmt.Sprintf("mercury: circuit breaker for %s is %s", key, transition.to), retryAfter)
+		return nil, false
+	}
+	// Only the first outcome counts, so callers may defer record(errAbandoned) to cover exits which never reach the backend
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			if err == errAbandoned {
+				b.abandon()
+				return
+			}
+			p.reportBreakerTransition(key, b.record(err), txid, loggers)
+		})
+	}, true
+}
+
+// errAbandoned is passed to the record function from checkBreaker when a request ends without an outcome for the backend
+var errAbandoned = errors.New("mercury: request abandoned before reaching the backend")
+
+func (p *Proxy) reportBreakerTransition(key string, transition breakerTransition, txid string, loggers []logs.Writer) {
+	if !transition.changed() {
+		return
+	}
+	for _, logger := range loggers {
+		logger.LogWarningf(txid, "mercury: circuit breaker for %s changed from %s to %s", key, transition.from, transition.to)
+	}
+	tags := map[string]string{"breaker": key, "from": transition.from.String(), "to": transition.to.String()}
+	p.count("mercury_breaker_transitions", tags)
+	for _, recorder := range p.getMetrics() {
+		recorder.Gauge("mercury_breaker_state", float64(transition.to), map[string]string{"breaker": key})
+	}
+}
+
+func (p *Proxy) count(name string, tags map[string]string) {
+	for _, recorder := range p.getMetrics() {
+		recorder.Count(name, 1, tags)
+	}
+}
@@ -0,0 +1,109 @@
+package convert
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// WeightedBackend is an alternate connection receiving a share of a procedure's traffic
+type WeightedBackend struct {
+	// Name identifies the backend in logs and metrics, e.g. "canary"
+	Name string
+	// Conn is the alternate connection
+	Conn grpc.ClientConnInterface
+	// Percent is the share of the procedure's requests sent to Conn, from 0 to 100
+	Percent float64
+}
+
+// Router splits traffic for procedures between the connection supplied to ProxyRequest and weighted alternate connections.
+// Routes may be changed at any time. Websocket streams are routed once when opened and stay on that backend for their lifetime
+type Router struct {
+	mu           sync.RWMutex
+	routes       map[string][]WeightedBackend
+	stickyHeader string
+	stickyCookie string
+}
+
+// NewRouter creates a new Router with no routes, sending all traffic to the connections supplied to ProxyRequest
+func NewRouter() *Router {
+	return &Router{
+		routes: map[string][]WeightedBackend{},
+	}
+}
+
+// SetRoute replaces the alternate backends for procedure. Any share not assigned to a backend goes to the connection supplied to ProxyRequest
+// Calling SetRoute with no backends removes the route
+func (r *Router) SetRoute(procedure string, backends ...WeightedBackend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(backends) == 0 {
+		delete(r.routes, procedure)
+		return
+	}
+	r.routes[procedure] = append([]WeightedBackend(nil), backends...)
+}
+
+// SetStickiness makes requests carrying the named header or cookie consistently route to the same backend, as long as the weights don't change.
+// The header is checked first. Either may be empty
+func (r *Router) SetStickiness(header, cookie string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stickyHeader = header
+	r.stickyCookie = cookie
+}
+
+// Route chooses the connection for a request, returning defaultConn and an empty name if no alternate backend was chosen
+func (r *Router) Route(req *http.Request, procedure string, defaultConn grpc.ClientConnInterface) (conn grpc.ClientConnInterface, name string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	backends, exists := r.routes[procedure]
+	if !exists {
+		return defaultConn, ""
+	}
+	point := r.stickyPoint(req)
+	if point < 0 {
+		point = rand.Float64() * 100
+	}
+	for _, backend := range backends {
+		if point < backend.Percent {
+			return backend.Conn, backend.Name
+		}
+		point -= backend.Percent
+	}
+	return defaultConn, ""
+}
+
+// stickyPoint hashes the sticky header or cookie to a point in [0, 100), or returns -1 if neither is present. It must be called with the lock held
+func (r *Router) stickyPoint(req *http.Request) float64 {
+	value := ""
+	if r.stickyHeader != "" {
+		value = req.Header.Get(r.stickyHeader)
+	}
+	if value == "" && r.stickyCookie != "" {
+		if cookie, err := req.Cookie(r.stickyCookie); err == nil {
+			value = cookie.Value
+		}
+	}
+	if value == "" {
+		return -1
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	return float64(hash.Sum64()%10000) / 100
+}
+
+// SetRouter sets the Router used to choose between connections for each request, nil sends all requests to the connection supplied to ProxyRequest
+func (p *Proxy) SetRouter(router *Router) {
+	p.router = router
+}
+
+func (p *Proxy) getRouter() *Router {
+	if p == nil {
+		return defaultProxy.router
+	}
+	return p.router
+}
@@ -0,0 +1,54 @@
+package convert
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestRouter_Route(t *testing.T) {
+	primary := &grpc.ClientConn{}
+	canary := &grpc.ClientConn{}
+	router := NewRouter()
+	router.SetStickiness("X-User", "session")
+	req := func(header, cookie string) *http.Request {
+		r := &http.Request{Header: http.Header{}}
+		if header != "" {
+			r.Header.Set("X-User", header)
+		}
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		return r
+	}
+	t.Run("no route", func(t *testing.T) {
+		conn, name := router.Route(req("", ""), "Random", primary)
+		assert.True(t, conn == primary)
+		assert.Equal(t, "", name)
+	})
+	t.Run("everything to canary", func(t *testing.T) {
+		router.SetRoute("Random", WeightedBackend{Name: "canary", Conn: canary, Percent: 100})
+		conn, name := router.Route(req("", ""), "Random", primary)
+		assert.True(t, conn == canary)
+		assert.Equal(t, "canary", name)
+	})
+	t.Run("sticky assignment", func(t *testing.T) {
+		router.SetRoute("Random", WeightedBackend{Name: "canary", Conn: canary, Percent: 50})
+		for _, user := range []string{"alice", "bob", "carol", "dave"} {
+			_, first := router.Route(req(user, ""), "Random", primary)
+			for i := 0; i < 20; i++ {
+				_, name := router.Route(req(user, ""), "Random", primary)
+				assert.Equal(t, first, name)
+				_, name = router.Route(req("", user), "Random", primary)
+				assert.Equal(t, first, name)
+			}
+		}
+	})
+	t.Run("route removed", func(t *testing.T) {
+		router.SetRoute("Random")
+		conn, _ := router.Route(req("alice", ""), "Random", primary)
+		assert.True(t, conn == primary)
+	})
+}
@@ -0,0 +1,55 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/LLKennedy/mercury/internal/drain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// GoingAwayMessage is sent to open websockets when the proxy or the backend begins shutting down, clients should reconnect elsewhere at their earliest convenience
+	GoingAwayMessage = "GOING_AWAY"
+	// ReasonShuttingDown is the ErrorInfo reason given when a request is rejected because the proxy is shutting down
+	ReasonShuttingDown = "SHUTTING_DOWN"
+	// TxidMetadata is the request metadata key which carries the transaction ID to the backend, so its logs can be matched with the proxy's
+	TxidMetadata = "mercury-txid"
+)
+
+// Shutdown stops the proxy accepting new requests, rejecting them with 503 Service Unavailable, and sends GoingAwayMessage to all open websockets
+// In-flight unary requests and streams are then given until ctx expires to finish, after which they are cancelled and ctx.Err() is returned
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	d := p.getDrainer()
+	idle := d.Close()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		d.CancelAll()
+		return ctx.Err()
+	}
+}
+
+func (p *Proxy) getDrainer() *drain.Drainer {
+	if p == nil {
+		return &defaultProxy.drain
+	}
+	return &p.drain
+}
+
+// beginRequest writes a 503 to w and returns ok = false if the proxy is shutting down, otherwise it returns the context to use for the request, carrying txid to the backend, and a function to call when it has finished
+func (p *Proxy) beginRequest(ctx context.Context, w http.ResponseWriter, txid string) (reqCtx context.Context, active *drain.Request, end func(), ok bool) {
+	d := p.getDrainer()
+	reqCtx, active, ok = d.Begin(ctx)
+	if !ok {
+		w.Header().Set("Connection", "close")
+		writeStatusError(w, http.StatusServiceUnavailable, codes.Unavailable, ReasonShuttingDown, "mercury: proxy is shutting down", 0)
+		return nil, nil, nil, false
+	}
+	if txid != "" {
+		reqCtx = metadata.AppendToOutgoingContext(reqCtx, TxidMetadata, txid)
+	}
+	return reqCtx, active, func() { d.End(active) }, true
+}
@@ -7,8 +7,11 @@ import (
 	"net/http"
 
 	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/drain"
 	"github.com/LLKennedy/mercury/logs"
 	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -16,44 +19,108 @@ const (
 	defaultBufferSize = 65536
 	// EOFMessage is the EOF message websockets must send to imitate gRPC CloseSend()
 	EOFMessage = "EOF"
+	// FieldsHeader is set on the routing information of websocket streams to the fields query param, which selects the fields kept in each response
+	FieldsHeader = "X-Mercury-Fields"
 )
 
+// proxyStream upgrades the request to a websocket and streams messages in both directions
+func (p *Proxy) proxyStream(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, active *drain.Request, txid string, loggers []logs.Writer) {
+	// The backend is chosen once here, so the stream stays on it for its whole lifetime
+	conn, release, record, ok := p.prepareBackend(ctx, w, r, procedure, conn, txid, loggers)
+	if !ok {
+		return
+	}
+	defer release()
+	// If the handshake fails the handler never runs, so nothing was learned about the backend
+	defer record(errAbandoned)
+	// The backend stream is opened during the handshake, and must not outlive it if the websocket is never served
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	handler := &stream{
+		ctx:       ctx,
+		remote:    httpapi.NewExposedServiceClient(conn),
+		loggers:   loggers,
+		procedure: procedure,
+		headers:   r.Header,
+		fields:    r.URL.Query()["fields"],
+		txid:      txid,
+		record:    record,
+		active:    active,
+	}
+	wssrv := &websocket.Server{
+		Handshake: handler.open,
+		Handler:   handler.Serve,
+	}
+	wssrv.ServeHTTP(w, r)
+}
+
 type stream struct {
 	ctx            context.Context
 	remote         httpapi.ExposedServiceClient
 	loggers        []logs.Writer
 	procedure      string
 	headers        http.Header
+	fields         []string
 	readBufferSize int
 	txid           string
+	record         func(err error)
+	active         *drain.Request
+	client         httpapi.ExposedService_ProxyStreamClient
+	openErr        error
 }
 
-func (h stream) Serve(c *websocket.Conn) {
+// open starts the backend stream before the handshake is answered, so the headers the backend sends, such as those announcing deprecation, can be sent with it.
+// Errors are kept for Serve to write to the websocket, rather than failing the handshake with a bare 403
+func (h *stream) open(config *websocket.Config, r *http.Request) error {
+	client, err := h.remote.ProxyStream(h.ctx)
+	if err == nil {
+		routingInfo := &httpapi.RoutingInformation{
+			Method:    httpapi.Method_GET,
+			Procedure: h.procedure,
+		}
+		routingInfo.Headers = map[string]*httpapi.MultiVal{}
+		for name, values := range h.headers {
+			newHeader := &httpapi.MultiVal{}
+			newHeader.Values = values
+			routingInfo.Headers[name] = newHeader
+		}
+		if len(h.fields) > 0 {
+			routingInfo.Headers[FieldsHeader] = &httpapi.MultiVal{Values: h.fields}
+		}
+		err = client.Send(&httpapi.StreamedRequest{
+			MessageType: &httpapi.StreamedRequest_Init{
+				Init: routingInfo,
+			},
+		})
+	}
+	var md metadata.MD
+	if err == nil {
+		md, err = client.Header()
+	}
+	if h.record != nil {
+		h.record(err)
+	}
+	h.client, h.openErr = client, err
+	config.Header = headersFromMetadata(md)
+	return nil
+}
+
+func (h *stream) Serve(c *websocket.Conn) {
 	errWriter := errorWriter{
 		c:       c,
 		loggers: h.loggers,
 		txid:    h.txid,
 	}
-	client, err := h.remote.ProxyStream(h.ctx)
-	if err != nil {
-		errWriter.writeWsErr("error initialising: ", err)
-		return
-	}
-	routingInfo := &httpapi.RoutingInformation{
-		Method:    httpapi.Method_GET,
-		Procedure: h.procedure,
+	if h.active != nil {
+		h.active.OnGoAway(func() {
+			c.Write([]byte(GoingAwayMessage))
+		})
 	}
-	routingInfo.Headers = map[string]*httpapi.MultiVal{}
-	for name, values := range h.headers {
-		newHeader := &httpapi.MultiVal{}
-		newHeader.Values = values
-		routingInfo.Headers[name] = newHeader
+	if h.openErr != nil {
+		errWriter.writeWsErr("error initialising: ", h.openErr)
+		return
 	}
-	err = client.Send(&httpapi.StreamedRequest{
-		MessageType: &httpapi.StreamedRequest_Init{
-			Init: routingInfo,
-		},
-	})
+	client := h.client
 	up := make(chan error, 1)
 	down := make(chan error, 1)
 	go h.up(c, client, up)
@@ -141,8 +208,13 @@ func (h *stream) down(c *websocket.Conn, client httpapi.ExposedService_ProxyStre
 			out <- fmt.Errorf("reading from service: %v", err)
 			return
 		}
-		// Send the message to the client
-		_, err = c.Write(msg.GetResponse())
+		if msg.GetGoingAway() {
+			// The backend is shutting down, which websocket clients are told in band
+			_, err = c.Write([]byte(GoingAwayMessage))
+		} else {
+			// Send the message to the client
+			_, err = c.Write(msg.GetResponse())
+		}
 		if err != nil {
 			out <- fmt.Errorf("writing to websocket: %v", err)
 			return
@@ -0,0 +1,35 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestProxy_proxyStream_headers(t *testing.T) {
+	conn := &fakeStreamConn{stream: &fakeStream{header: metadata.Pairs("deprecation", "true", "grpc-internal", "x")}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewProxy().ProxyRequest(context.Background(), w, r, "GetFeed", conn, "")
+	}))
+	defer server.Close()
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/GetFeed", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	res, err := http.DefaultClient.Do(r)
+	if assert.NoError(t, err) {
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+		assert.Equal(t, "true", res.Header.Get("Deprecation"))
+		assert.Empty(t, res.Header.Get("Grpc-Internal"))
+	}
+	if assert.NotEmpty(t, conn.stream.sent) {
+		assert.Equal(t, "GetFeed", conn.stream.sent[0].GetInit().GetProcedure())
+	}
+}
@@ -2,84 +2,265 @@ package convert
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 
 	"github.com/LLKennedy/mercury/httpapi"
 	"github.com/LLKennedy/mercury/logs"
-	"golang.org/x/net/websocket"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 // ProxyRequest proxies an HTTP(S) or WS(S) request through a GRPC connection compliant with mercury/httpapi
 func ProxyRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, txid string, loggers ...logs.Writer) {
-	remote := httpapi.NewExposedServiceClient(conn)
-	isWebsocket := false
+	defaultProxy.ProxyRequest(ctx, w, r, procedure, conn, txid, loggers...)
+}
+
+// ProxyRequest proxies an HTTP(S) or WS(S) request through a GRPC connection compliant with mercury/httpapi, applying the behaviour configured on p
+func (p *Proxy) ProxyRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, txid string, loggers ...logs.Writer) {
+	ctx, active, end, ok := p.beginRequest(ctx, w, txid)
+	if !ok {
+		return
+	}
+	defer end()
+	procedure, ok = p.matchProcedure(w, r, procedure)
+	if !ok {
+		return
+	}
 	upgradeHader, ok := r.Header["Upgrade"]
-	if ok {
-		isWebsocket = len(upgradeHader) >= 1 && upgradeHader[0] == "websocket"
-	}
-	if isWebsocket {
-		// Stream request
-		handler := stream{
-			ctx:       ctx,
-			remote:    remote,
-			loggers:   loggers,
-			procedure: procedure,
-			headers:   r.Header,
-			txid:      txid,
-		}
-		wssrv := &websocket.Server{
-			Handler: handler.Serve,
-		}
-		wssrv.ServeHTTP(w, r)
+	if ok && len(upgradeHader) >= 1 && upgradeHader[0] == "websocket" {
+		p.proxyStream(ctx, w, r, procedure, conn, active, txid, loggers)
+		return
+	}
+	if p.isDownload(r, procedure) {
+		p.proxyDownload(ctx, w, r, procedure, conn, txid, loggers)
 		return
 	}
-	// Unary request
+	if p.isUpload(r, procedure) {
+		p.proxyUpload(ctx, w, r, procedure, conn, txid, loggers)
+		return
+	}
+	p.proxyUnary(ctx, w, r, procedure, conn, txid, loggers)
+}
+
+// proxyUnary proxies a single HTTP request and response
+func (p *Proxy) proxyUnary(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, txid string, loggers []logs.Writer) {
 	req := RequestFromRequest(r)
 	req.Procedure = procedure
-	bodyBytes, err := ioutil.ReadAll(r.Body)
-	req.Payload = bodyBytes
+	served, store := p.checkCache(w, r, req)
+	if served {
+		return
+	}
+	if isMultipart(r) {
+		if !p.readMultipart(w, r, req, txid, loggers) {
+			return
+		}
+	} else {
+		bodyBytes, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeStatusError(w, http.StatusBadRequest, codes.InvalidArgument, ReasonInvalidBody, fmt.Sprintf("mercury: failed to read request body: %v", err), 0)
+			return
+		}
+		req.Payload = bodyBytes
+	}
+	served, complete := p.checkIdempotency(w, r, req)
+	if served {
+		return
+	}
+	var out *unaryResponse
+	if complete != nil {
+		// A nil response releases the key, in case the call panics
+		defer func() { complete(out) }()
+	}
+	out = p.coalesce(ctx, r, req, txid, loggers, func(ctx context.Context) *unaryResponse {
+		return p.callBackend(ctx, r, req, conn, txid, loggers)
+	})
+	if store != nil {
+		store(out)
+	}
+	out.write(w, r)
+}
+
+// callBackend forwards a unary request to the backend, converting any rejection or error into the response
+func (p *Proxy) callBackend(ctx context.Context, r *http.Request, req *httpapi.Request, conn grpc.ClientConnInterface, txid string, loggers []logs.Writer) *unaryResponse {
+	capture := newResponseCapture()
+	conn, release, record, ok := p.prepareBackend(ctx, capture, r, req.GetProcedure(), conn, txid, loggers)
+	if !ok {
+		return capture.response()
+	}
+	defer release()
+	remote := httpapi.NewExposedServiceClient(conn)
 	// Forward the actual GRPC request
-	var errStatus *status.Status
-	res, err := remote.ProxyUnary(ctx, req)
+	ctx = withConditionalMetadata(ctx, r)
+	primaryDone := p.mirrorUnary(ctx, req, txid, loggers)
+	md := metadata.MD{}
+	res, err := remote.ProxyUnary(ctx, req, grpc.Header(&md))
+	primaryDone(res, err)
+	record(err)
 	if err != nil {
-		// GRPC call failed, let's log it, process an error status
+		// GRPC call failed, let's log it
 		for _, logger := range loggers {
 			logger.LogErrorf(txid, "mercury: received error from target service: %v", err)
 		}
-		var ok bool
-		errStatus, ok = status.FromError(err)
-		if !ok {
-			// Can't get proper status code, return bad gateway
-			w.WriteHeader(http.StatusBadGateway)
-		} else {
-			w.WriteHeader(GRPCStatusToHTTPStatusCode(errStatus.Code()))
+	}
+	return newUnaryResponse(res, md, err)
+}
+
+// prepareBackend routes the request and applies concurrency limits and circuit breaking for the chosen backend, writing an error to w and returning ok = false if the request cannot proceed
+func (p *Proxy) prepareBackend(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, txid string, loggers []logs.Writer) (routed grpc.ClientConnInterface, release func(), record func(err error), ok bool) {
+	if router := p.getRouter(); router != nil {
+		var routeName string
+		conn, routeName = router.Route(r, procedure, conn)
+		if routeName != "" {
+			for _, logger := range loggers {
+				logger.LogTracef(txid, "mercury: routing %s to %s", procedure, routeName)
+			}
+			p.count("mercury_routed_requests", map[string]string{"procedure": procedure, "route": routeName})
 		}
-	} else {
-		// No grpc error, get (presumably) success code from response
-		w.WriteHeader(int(res.GetStatusCode()))
 	}
-	// Write response body
+	backend := p.getBackendKey(procedure, conn)
+	release, ok = p.acquireSlots(ctx, w, procedure, backend, txid, loggers)
+	if !ok {
+		return
+	}
+	record, ok = p.checkBreaker(w, procedure, backend, txid, loggers)
+	if !ok {
+		release()
+		return
+	}
+	return conn, release, record, true
+}
+
+// unaryResponse is a unary response ready to be written to the client
+type unaryResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// newUnaryResponse converts the result of a ProxyUnary call to a unaryResponse
+func newUnaryResponse(res *httpapi.Response, md metadata.MD, err error) *unaryResponse {
+	out := &unaryResponse{
+		header: headersFromMetadata(md),
+	}
 	for name, values := range res.GetWriteHeaders() {
 		for _, value := range values.GetValues() {
-			w.Header().Add(name, value)
+			out.header.Add(name, value)
 		}
 	}
-	if errStatus == nil {
-		if len(res.GetPayload()) < 1 {
-			w.Write([]byte("{}"))
+	if err != nil {
+		errStatus, ok := status.FromError(err)
+		if !ok {
+			// Can't get proper status code, return bad gateway
+			out.statusCode = http.StatusBadGateway
 		} else {
-			w.Write(res.GetPayload())
+			out.statusCode = httpStatusFromError(errStatus)
+		}
+		out.body = []byte(errStatus.Message())
+		if isMercuryError(errStatus) {
+			// Details such as a BadRequest listing invalid fields are only useful to the client as the full status
+			if body, err := protojson.Marshal(errStatus.Proto()); err == nil {
+				out.header.Set("Content-Type", "application/json")
+				out.body = body
+			}
 		}
+		return out
+	}
+	// No grpc error, get (presumably) success code from response
+	out.statusCode = int(res.GetStatusCode())
+	if len(res.GetPayload()) < 1 && out.header.Get("Content-Type") == "" {
+		// Empty JSON messages are omitted by the backend, but raw bodies with their own content type may really be empty
+		out.body = []byte("{}")
 	} else {
-		w.Write([]byte(errStatus.Message()))
+		out.body = res.GetPayload()
 	}
-	return
+	return out
+}
+
+// clone copies the response so its headers may be changed independently, the body is shared and must not be modified
+func (u *unaryResponse) clone() *unaryResponse {
+	return &unaryResponse{
+		statusCode: u.statusCode,
+		header:     cloneHeader(u.header),
+		body:       u.body,
+	}
+}
+
+// write writes the response to w, replacing it with 304 Not Modified if it matches a conditional GET
+func (u *unaryResponse) write(w http.ResponseWriter, r *http.Request) {
+	for name, values := range u.header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	if u.notModified(r) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(u.statusCode)
+	if r.Method == http.MethodHead || u.statusCode == http.StatusNoContent {
+		return
+	}
+	w.Write(u.body)
+}
+
+// notModified returns true if r is a GET or HEAD whose If-None-Match matches the response's ETag
+func (u *unaryResponse) notModified(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || u.statusCode != http.StatusOK {
+		return false
+	}
+	etag := u.header.Get("ETag")
+	return etag != "" && etagMatches(r.Header.Get("If-None-Match"), etag)
+}
 
+// responseCapture is an http.ResponseWriter which buffers the response so it can be converted to a unaryResponse
+type responseCapture struct {
+	res *unaryResponse
+}
+
+func newResponseCapture() *responseCapture {
+	return &responseCapture{
+		res: &unaryResponse{
+			statusCode: http.StatusOK,
+			header:     http.Header{},
+		},
+	}
+}
+
+func (c *responseCapture) Header() http.Header {
+	return c.res.header
+}
+
+func (c *responseCapture) Write(data []byte) (int, error) {
+	c.res.body = append(c.res.body, data...)
+	return len(data), nil
+}
+
+func (c *responseCapture) WriteHeader(statusCode int) {
+	c.res.statusCode = statusCode
+}
+
+func (c *responseCapture) response() *unaryResponse {
+	return c.res
+}
+
+// headersFromMetadata converts gRPC response header metadata to HTTP headers, skipping those used by gRPC itself
+func headersFromMetadata(md metadata.MD) http.Header {
+	header := http.Header{}
+	for key, values := range md {
+		if key == "content-type" || strings.HasPrefix(key, "grpc-") || strings.HasPrefix(key, ":") || strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return header
 }
 
 // RequestFromRequest creates a *httpapi.Request from *http.Request filling all values except body, which could error
@@ -91,6 +272,7 @@ func RequestFromRequest(r *http.Request) *httpapi.Request {
 		newHeader.Values = values
 		req.Headers[name] = newHeader
 	}
+	req.Headers[PathHeader] = &httpapi.MultiVal{Values: []string{r.URL.EscapedPath()}}
 	req.Method = MethodFromString(r.Method)
 	req.Params = map[string]*httpapi.MultiVal{}
 	for name, values := range r.URL.Query() {
@@ -0,0 +1,108 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// UploadHeader is set on the routing information of upload streams to the request's raw query string, telling the backend to build the first request from it and expect raw chunks of the body
+	UploadHeader = "X-Mercury-Upload"
+	// ReasonInvalidBody is the ErrorInfo reason given when the request body can't be read
+	ReasonInvalidBody = "INVALID_BODY"
+)
+
+// SetUploadProcedures sets the client-streaming procedures whose POST and PUT request bodies are streamed to the backend in chunks as they arrive, rather than read into memory first.
+// The backend must know which field of the procedure's request messages receives each chunk, see proxy.Server.SetUpload
+func (p *Proxy) SetUploadProcedures(procedures ...string) {
+	uploads := map[string]bool{}
+	for _, procedure := range procedures {
+		uploads[procedure] = true
+	}
+	p.uploads = uploads
+}
+
+// isUpload is true if the request body should be streamed to the backend
+func (p *Proxy) isUpload(r *http.Request, procedure string) bool {
+	uploads := defaultProxy.uploads
+	if p != nil {
+		uploads = p.uploads
+	}
+	return uploads[procedure] && (r.Method == http.MethodPost || r.Method == http.MethodPut)
+}
+
+// proxyUpload streams the request body to a client-streaming procedure in chunks, holding at most one chunk in memory, and responds with its single response
+func (p *Proxy) proxyUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, procedure string, conn grpc.ClientConnInterface, txid string, loggers []logs.Writer) {
+	capture := newResponseCapture()
+	conn, release, record, ok := p.prepareBackend(ctx, capture, r, procedure, conn, txid, loggers)
+	if !ok {
+		capture.response().write(w, r)
+		return
+	}
+	defer release()
+	// Exits before the backend answers, like an unreadable body, say nothing about the backend but must still free a half-open probe slot
+	defer record(errAbandoned)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client, err := httpapi.NewExposedServiceClient(conn).ProxyStream(withConditionalMetadata(ctx, r))
+	if err == nil {
+		req := RequestFromRequest(r)
+		req.Headers[UploadHeader] = &httpapi.MultiVal{Values: []string{r.URL.RawQuery}}
+		err = client.Send(&httpapi.StreamedRequest{
+			MessageType: &httpapi.StreamedRequest_Init{
+				Init: &httpapi.RoutingInformation{
+					Method:    req.GetMethod(),
+					Procedure: procedure,
+					Headers:   req.GetHeaders(),
+				},
+			},
+		})
+	}
+	buffer := make([]byte, defaultBufferSize)
+	// The first chunk is always sent, even if the body is empty, as it carries the fields from the query string and path
+	for first := true; err == nil; first = false {
+		n, readErr := io.ReadFull(r.Body, buffer)
+		if n > 0 || first {
+			// Send copies the chunk into its own buffer, so ours can be reused
+			err = client.Send(&httpapi.StreamedRequest{
+				MessageType: &httpapi.StreamedRequest_Request{
+					Request: buffer[:n],
+				},
+			})
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			writeStatusError(w, http.StatusBadRequest, codes.InvalidArgument, ReasonInvalidBody, fmt.Sprintf("mercury: failed to read request body: %v", readErr), 0)
+			return
+		}
+	}
+	// io.EOF from Send means the backend has already finished, and the reason is returned by Recv
+	if err == nil || err == io.EOF {
+		err = client.CloseSend()
+	}
+	var res *httpapi.StreamedResponse
+	if err == nil {
+		res, err = recvData(client)
+	}
+	record(err)
+	if err != nil {
+		for _, logger := range loggers {
+			logger.LogErrorf(txid, "mercury: received error from target service: %v", err)
+		}
+	}
+	var md metadata.MD
+	if client != nil {
+		md, _ = client.Header()
+	}
+	newUnaryResponse(&httpapi.Response{StatusCode: http.StatusOK, Payload: res.GetResponse()}, md, err).write(w, r)
+}
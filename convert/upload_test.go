@@ -0,0 +1,91 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingReader returns err after the data runs out
+type failingReader struct {
+	data *bytes.Reader
+	err  error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.data.Len() == 0 {
+		return 0, f.err
+	}
+	return f.data.Read(p)
+}
+
+func TestProxy_proxyUpload(t *testing.T) {
+	p := NewProxy()
+	p.SetUploadProcedures("PostArchive")
+	upload := func(stream *fakeStream, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/PostArchive?name=backup", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "PostArchive", &fakeStreamConn{stream: stream}, "")
+		return w
+	}
+	t.Run("chunks", func(t *testing.T) {
+		stream := &fakeStream{responses: [][]byte{[]byte(`{"size":"65546"}`)}}
+		body := bytes.Repeat([]byte("a"), defaultBufferSize+10)
+		w := upload(stream, body)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"size":"65546"}`, w.Body.String())
+		assert.True(t, stream.closed)
+		if assert.Len(t, stream.sent, 3) {
+			init := stream.sent[0].GetInit()
+			assert.Equal(t, httpapi.Method_POST, init.GetMethod())
+			assert.Equal(t, []string{"name=backup"}, init.GetHeaders()[UploadHeader].GetValues())
+			assert.Len(t, stream.sent[1].GetRequest(), defaultBufferSize)
+			assert.Len(t, stream.sent[2].GetRequest(), 10)
+		}
+	})
+	t.Run("going away", func(t *testing.T) {
+		w := upload(&fakeStream{responses: [][]byte{nil, []byte(`{"size":"4"}`)}}, []byte("data"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"size":"4"}`, w.Body.String())
+	})
+	t.Run("empty body", func(t *testing.T) {
+		stream := &fakeStream{responses: [][]byte{[]byte(`{}`)}}
+		assert.Equal(t, http.StatusOK, upload(stream, nil).Code)
+		if assert.Len(t, stream.sent, 2) {
+			assert.Empty(t, stream.sent[1].GetRequest())
+		}
+	})
+	t.Run("backend error", func(t *testing.T) {
+		w := upload(&fakeStream{err: status.Error(codes.InvalidArgument, "not an archive")}, []byte("data"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "not an archive", w.Body.String())
+	})
+	t.Run("unreadable body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/PostArchive", &failingReader{data: bytes.NewReader([]byte("partial")), err: errors.New("connection reset")})
+		w := httptest.NewRecorder()
+		p.ProxyRequest(context.Background(), w, r, "PostArchive", &fakeStreamConn{stream: &fakeStream{}}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ReasonInvalidBody)
+	})
+}
+
+func TestProxy_proxyUnary_unreadableBody(t *testing.T) {
+	conn := &fakeConn{respond: func(req *httpapi.Request) (*httpapi.Response, error) {
+		return &httpapi.Response{StatusCode: http.StatusOK}, nil
+	}}
+	r := httptest.NewRequest(http.MethodPost, "/UploadPhoto", &failingReader{data: bytes.NewReader([]byte(`{"data":`)), err: errors.New("connection reset")})
+	w := httptest.NewRecorder()
+	NewProxy().ProxyRequest(context.Background(), w, r, "UploadPhoto", conn, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "connection reset"))
+	assert.Empty(t, conn.requests)
+}
@@ -0,0 +1,204 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        v3.10.1
+// source: deprecation.proto
+
+package deprecation
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	descriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// Sunset describes the retirement of a deprecated method, e.g. option (mercury.deprecation.sunset) = {date: "2021-06-30", successor: "/v2/photos"};
+type Sunset struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Since is when the method was deprecated, as an RFC 3339 date or date and time
+	Since *string `protobuf:"bytes,1,opt,name=since" json:"since,omitempty"`
+	// Date is when the method stops working, as an RFC 3339 date or date and time
+	Date *string `protobuf:"bytes,2,opt,name=date" json:"date,omitempty"`
+	// Successor is a link to the method which replaces it
+	Successor *string `protobuf:"bytes,3,opt,name=successor" json:"successor,omitempty"`
+}
+
+func (x *Sunset) Reset() {
+	*x = Sunset{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_deprecation_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Sunset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sunset) ProtoMessage() {}
+
+func (x *Sunset) ProtoReflect() protoreflect.Message {
+	mi := &file_deprecation_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sunset.ProtoReflect.Descriptor instead.
+func (*Sunset) Descriptor() ([]byte, []int) {
+	return file_deprecation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Sunset) GetSince() string {
+	if x != nil && x.Since != nil {
+		return *x.Since
+	}
+	return ""
+}
+
+func (x *Sunset) GetDate() string {
+	if x != nil && x.Date != nil {
+		return *x.Date
+	}
+	return ""
+}
+
+func (x *Sunset) GetSuccessor() string {
+	if x != nil && x.Successor != nil {
+		return *x.Successor
+	}
+	return ""
+}
+
+var file_deprecation_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptor.MethodOptions)(nil),
+		ExtensionType: (*Sunset)(nil),
+		Field:         51721,
+		Name:          "mercury.deprecation.sunset",
+		Tag:           "bytes,51721,opt,name=sunset",
+		Filename:      "deprecation.proto",
+	},
+}
+
+// Extension fields to descriptor.MethodOptions.
+var (
+	// Sunset describes the retirement of a method marked with option deprecated = true, which proxy.Server announces in the headers of every response
+	//
+	// optional mercury.deprecation.Sunset sunset = 51721;
+	E_Sunset = &file_deprecation_proto_extTypes[0]
+)
+
+var File_deprecation_proto protoreflect.FileDescriptor
+
+var file_deprecation_proto_rawDesc = []byte{
+	0x0a, 0x11, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x13, 0x6d, 0x65, 0x72, 0x63, 0x75, 0x72, 0x79, 0x2e, 0x64, 0x65, 0x70,
+	0x72, 0x65, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69,
+	0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x50, 0x0a, 0x06, 0x53, 0x75,
+	0x6e, 0x73, 0x65, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x69, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x69, 0x6e, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61,
+	0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74, 0x65, 0x12, 0x1c,
+	0x0a, 0x09, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x3a, 0x55, 0x0a, 0x06,
+	0x73, 0x75, 0x6e, 0x73, 0x65, 0x74, 0x12, 0x1e, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x89, 0x94, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b,
+	0x2e, 0x6d, 0x65, 0x72, 0x63, 0x75, 0x72, 0x79, 0x2e, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x53, 0x75, 0x6e, 0x73, 0x65, 0x74, 0x52, 0x06, 0x73, 0x75, 0x6e,
+	0x73, 0x65, 0x74, 0x42, 0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
+	0x6d, 0x2f, 0x4c, 0x4c, 0x4b, 0x65, 0x6e, 0x6e, 0x65, 0x64, 0x79, 0x2f, 0x6d, 0x65, 0x72, 0x63,
+	0x75, 0x72, 0x79, 0x2f, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x32,
+}
+
+var (
+	file_deprecation_proto_rawDescOnce sync.Once
+	file_deprecation_proto_rawDescData = file_deprecation_proto_rawDesc
+)
+
+func file_deprecation_proto_rawDescGZIP() []byte {
+	file_deprecation_proto_rawDescOnce.Do(func() {
+		file_deprecation_proto_rawDescData = protoimpl.X.CompressGZIP(file_deprecation_proto_rawDescData)
+	})
+	return file_deprecation_proto_rawDescData
+}
+
+var file_deprecation_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_deprecation_proto_goTypes = []interface{}{
+	(*Sunset)(nil),                   // 0: mercury.deprecation.Sunset
+	(*descriptor.MethodOptions)(nil), // 1: google.protobuf.MethodOptions
+}
+var file_deprecation_proto_depIdxs = []int32{
+	1, // 0: mercury.deprecation.sunset:extendee -> google.protobuf.MethodOptions
+	0, // 1: mercury.deprecation.sunset:type_name -> mercury.deprecation.Sunset
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	1, // [1:2] is the sub-list for extension type_name
+	0, // [0:1] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_deprecation_proto_init() }
+func file_deprecation_proto_init() {
+	if File_deprecation_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_deprecation_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Sunset); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_deprecation_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 1,
+			NumServices:   0,
+		},
+		GoTypes:           file_deprecation_proto_goTypes,
+		DependencyIndexes: file_deprecation_proto_depIdxs,
+		MessageInfos:      file_deprecation_proto_msgTypes,
+		ExtensionInfos:    file_deprecation_proto_extTypes,
+	}.Build()
+	File_deprecation_proto = out.File
+	file_deprecation_proto_rawDesc = nil
+	file_deprecation_proto_goTypes = nil
+	file_deprecation_proto_depIdxs = nil
+}
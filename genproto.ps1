@@ -10,6 +10,8 @@ $ProtoFiles = Get-ChildItem -path $Directory -Recurse -Include $IncludeRule | Wh
 foreach ($file in $ProtoFiles) {
 	protoc --proto_path="$($file.DirectoryName)" --go_out=paths=source_relative:$PBPath --go-grpc_out=paths=source_relative:$PBPath $file.FullName
 }
+protoc --proto_path="./validate" --go_out=paths=source_relative:./validate ./validate/validate.proto
+protoc --proto_path="./deprecation" --go_out=paths=source_relative:./deprecation ./deprecation/deprecation.proto
 $Directory = "./internal/testservice/service"
 $IncludeRule = "*.proto"
 $ExcludeRUle = [Regex]'.*google.*|.*audit/.*|.*node_modules.*'
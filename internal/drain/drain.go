@@ -0,0 +1,113 @@
+package drain
+
+import (
+	"context"
+	"sync"
+)
+
+// Drainer tracks in-flight requests so they can be drained on shutdown. The zero value is ready to use
+type Drainer struct {
+	mu      sync.Mutex
+	closing bool
+	active  map[*Request]struct{}
+	idle    chan struct{}
+}
+
+// Request is an in-flight request tracked by a Drainer
+type Request struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	goAway    func()
+	goingAway bool
+	ended     bool
+}
+
+// OnGoAway sets the function called when the proxy begins shutting down, calling it immediately if that has already happened
+func (a *Request) OnGoAway(goAway func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.goAway = goAway
+	if a.goingAway && !a.ended {
+		goAway()
+	}
+}
+
+func (a *Request) sendGoAway() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.goingAway = true
+	if a.goAway != nil && !a.ended {
+		a.goAway()
+	}
+}
+
+// end stops the go-away function being called, waiting for it to return if it's already running
+func (a *Request) end() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ended = true
+}
+
+// Begin registers a new in-flight request, returning a context which is cancelled if shutdown times out
+func (d *Drainer) Begin(ctx context.Context) (reqCtx context.Context, active *Request, ok bool) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		return nil, nil, false
+	}
+	if d.active == nil {
+		d.active = map[*Request]struct{}{}
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	active = &Request{cancel: cancel}
+	d.active[active] = struct{}{}
+	return reqCtx, active, true
+}
+
+// End marks a request as finished, once any go-away function already running for it has returned
+func (d *Drainer) End(active *Request) {
+	active.cancel()
+	active.end()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.active, active)
+	if d.closing && len(d.active) == 0 {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// Close stops new requests and tells open streams to go away, returning a channel which is closed once all requests have finished
+func (d *Drainer) Close() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closing {
+		d.closing = true
+		d.idle = make(chan struct{})
+		if len(d.active) == 0 {
+			close(d.idle)
+			d.idle = nil
+		}
+		for active := range d.active {
+			go active.sendGoAway()
+		}
+	}
+	if d.idle == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return d.idle
+}
+
+// CancelAll cancels the contexts of all in-flight requests
+func (d *Drainer) CancelAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for active := range d.active {
+		active.cancel()
+	}
+}
@@ -0,0 +1,69 @@
+package drain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainer(t *testing.T) {
+	d := &Drainer{}
+	ctx, active, ok := d.Begin(context.Background())
+	assert.True(t, ok)
+	goneAway := make(chan struct{})
+	active.OnGoAway(func() { close(goneAway) })
+	idle := d.Close()
+	<-goneAway
+	_, _, ok = d.Begin(context.Background())
+	assert.False(t, ok)
+	select {
+	case <-idle:
+		t.Fatal("drainer idle with request still active")
+	default:
+	}
+	d.CancelAll()
+	assert.Error(t, ctx.Err())
+	d.End(active)
+	<-idle
+	<-d.Close()
+}
+
+func TestRequest_OnGoAwayAfterClose(t *testing.T) {
+	d := &Drainer{}
+	_, active, _ := d.Begin(context.Background())
+	d.Close()
+	called := make(chan struct{})
+	go active.OnGoAway(func() { close(called) })
+	<-called
+	d.End(active)
+}
+
+func TestDrainer_EndWaitsForGoAway(t *testing.T) {
+	d := &Drainer{}
+	_, active, _ := d.Begin(nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	active.OnGoAway(func() {
+		close(started)
+		<-release
+	})
+	d.Close()
+	<-started
+	ended := make(chan struct{})
+	go func() {
+		d.End(active)
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		t.Fatal("request ended while its go-away function was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-ended
+	called := false
+	active.OnGoAway(func() { called = true })
+	assert.False(t, called)
+}
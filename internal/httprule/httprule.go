@@ -0,0 +1,93 @@
+package httprule
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Binding is a single HTTP method and path template a procedure is exposed on
+type Binding struct {
+	// Method is the upper case HTTP method, e.g. GET
+	Method string
+	// Template is the parsed path template
+	Template *Template
+	// Body is the request field the HTTP body maps to, "*" for the whole request message or empty for no body
+	Body string
+}
+
+// Bindings returns the bindings described by the google.api.http option on method, including any additional bindings, or nil if it has none
+func Bindings(method protoreflect.MethodDescriptor) ([]Binding, error) {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || options == nil || !proto.HasExtension(options, annotations.E_Http) {
+		return nil, nil
+	}
+	rule, ok := proto.GetExtension(options, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil, nil
+	}
+	bindings := []Binding{}
+	rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+	for _, rule := range rules {
+		binding, err := fromRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("google.api.http option on %s: %v", method.FullName(), err)
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, nil
+}
+
+func fromRule(rule *annotations.HttpRule) (Binding, error) {
+	var method, path string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, path = "GET", pattern.Get
+	case *annotations.HttpRule_Put:
+		method, path = "PUT", pattern.Put
+	case *annotations.HttpRule_Post:
+		method, path = "POST", pattern.Post
+	case *annotations.HttpRule_Delete:
+		method, path = "DELETE", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		method, path = "PATCH", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		method, path = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return Binding{}, fmt.Errorf("no HTTP method set")
+	}
+	template, err := Parse(path)
+	if err != nil {
+		return Binding{}, err
+	}
+	return Binding{
+		Method:   method,
+		Template: template,
+		Body:     rule.GetBody(),
+	}, nil
+}
+
+// Match returns the first binding for httpMethod whose template matches path, along with the values of its variables
+func Match(bindings []Binding, httpMethod, path string) (binding Binding, vars map[string]string, ok bool) {
+	for _, binding := range bindings {
+		if binding.Method != httpMethod {
+			continue
+		}
+		if vars, ok := binding.Template.Match(path); ok {
+			return binding, vars, true
+		}
+	}
+	return Binding{}, nil, false
+}
+
+// Procedure strips the HTTP method prefix from a method name to give the mercury procedure name, as long as the prefix matches httpMethod
+func Procedure(methodName, httpMethod string) (string, bool) {
+	if len(methodName) <= len(httpMethod) || !strings.EqualFold(methodName[:len(httpMethod)], httpMethod) {
+		return "", false
+	}
+	return methodName[len(httpMethod):], true
+}
@@ -0,0 +1,55 @@
+package httprule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestBindings(t *testing.T) {
+	options := &descriptorpb.MethodOptions{}
+	proto.SetExtension(options, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/photos/{photo_id}"},
+		AdditionalBindings: []*annotations.HttpRule{
+			{Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{Kind: "get", Path: "/v1/albums/{album}/photos/{photo_id}"}}},
+		},
+	})
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("photos.proto"),
+		Package:     proto.String("photos"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Photo")}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Photos"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetPhoto"), InputType: proto.String(".photos.Photo"), OutputType: proto.String(".photos.Photo"), Options: options},
+				{Name: proto.String("PostPhoto"), InputType: proto.String(".photos.Photo"), OutputType: proto.String(".photos.Photo")},
+			},
+		}},
+	}, nil)
+	assert.NoError(t, err)
+	methods := file.Services().Get(0).Methods()
+	bindings, err := Bindings(methods.Get(0))
+	assert.NoError(t, err)
+	if assert.Len(t, bindings, 2) {
+		assert.Equal(t, "GET", bindings[0].Method)
+		assert.Equal(t, "/v1/photos/{photo_id}", bindings[0].Template.String())
+		assert.Equal(t, "GET", bindings[1].Method)
+		binding, vars, ok := Match(bindings, "GET", "/v1/albums/a/photos/p")
+		assert.True(t, ok)
+		assert.Equal(t, bindings[1].Template, binding.Template)
+		assert.Equal(t, map[string]string{"album": "a", "photo_id": "p"}, vars)
+	}
+	bindings, err = Bindings(methods.Get(1))
+	assert.NoError(t, err)
+	assert.Nil(t, bindings)
+	procedure, ok := Procedure("GetPhoto", "GET")
+	assert.True(t, ok)
+	assert.Equal(t, "Photo", procedure)
+	_, ok = Procedure("GetPhoto", "POST")
+	assert.False(t, ok)
+}
@@ -0,0 +1,228 @@
+// Package httprule parses google.api.http annotations and matches URL paths against their path templates
+package httprule
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	segmentLiteral segmentKind = iota
+	segmentWildcard
+	segmentDeepWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+// variable binds the path segments from start up to but not including end to a field path, end is -1 if the variable ends with a deep wildcard
+type variable struct {
+	fieldPath string
+	start     int
+	end       int
+}
+
+// Template is a parsed google.api.http path template such as /v1/{name=shelves/*/books/*}:publish
+type Template struct {
+	raw       string
+	segments  []segment
+	variables []variable
+	verb      string
+}
+
+// Parse parses a path template
+func Parse(template string) (*Template, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("path template %q must begin with /", template)
+	}
+	t := &Template{raw: template}
+	path := template[1:]
+	if i := strings.LastIndex(path, ":"); i >= 0 && i > strings.LastIndex(path, "}") && i > strings.LastIndex(path, "/") {
+		t.verb = path[i+1:]
+		path = path[:i]
+		if t.verb == "" {
+			return nil, fmt.Errorf("path template %q has an empty verb", template)
+		}
+	}
+	for len(path) > 0 {
+		if path[0] == '{' {
+			end := strings.Index(path, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("path template %q has an unterminated variable", template)
+			}
+			if err := t.parseVariable(path[1:end]); err != nil {
+				return nil, fmt.Errorf("path template %q: %v", template, err)
+			}
+			path = path[end+1:]
+		} else {
+			end := strings.Index(path, "/")
+			if end < 0 {
+				end = len(path)
+			}
+			if err := t.addSegment(path[:end]); err != nil {
+				return nil, fmt.Errorf("path template %q: %v", template, err)
+			}
+			path = path[end:]
+		}
+		if len(path) > 0 {
+			if path[0] != '/' || len(path) == 1 {
+				return nil, fmt.Errorf("path template %q has an invalid segment separator", template)
+			}
+			path = path[1:]
+		}
+	}
+	if len(t.segments) == 0 {
+		return nil, fmt.Errorf("path template %q has no segments", template)
+	}
+	for i, seg := range t.segments {
+		if seg.kind == segmentDeepWildcard && i != len(t.segments)-1 {
+			return nil, fmt.Errorf("path template %q may only use ** as its final segment", template)
+		}
+	}
+	return t, nil
+}
+
+func (t *Template) parseVariable(body string) error {
+	fieldPath, pattern := body, "*"
+	if i := strings.Index(body, "="); i >= 0 {
+		fieldPath, pattern = body[:i], body[i+1:]
+	}
+	for _, name := range strings.Split(fieldPath, ".") {
+		if !isIdent(name) {
+			return fmt.Errorf("invalid field path %q", fieldPath)
+		}
+	}
+	if strings.ContainsAny(pattern, "{}") || pattern == "" {
+		return fmt.Errorf("invalid pattern for variable %s", fieldPath)
+	}
+	for _, existing := range t.variables {
+		if existing.fieldPath == fieldPath {
+			return fmt.Errorf("field path %s is bound more than once", fieldPath)
+		}
+	}
+	v := variable{fieldPath: fieldPath, start: len(t.segments)}
+	for _, part := range strings.Split(pattern, "/") {
+		if err := t.addSegment(part); err != nil {
+			return err
+		}
+	}
+	v.end = len(t.segments)
+	if t.segments[len(t.segments)-1].kind == segmentDeepWildcard {
+		v.end = -1
+	}
+	t.variables = append(t.variables, v)
+	return nil
+}
+
+func (t *Template) addSegment(part string) error {
+	switch {
+	case part == "*":
+		t.segments = append(t.segments, segment{kind: segmentWildcard})
+	case part == "**":
+		t.segments = append(t.segments, segment{kind: segmentDeepWildcard})
+	case part == "" || strings.ContainsAny(part, "*{}=:"):
+		return fmt.Errorf("invalid segment %q", part)
+	default:
+		literal, err := url.PathUnescape(part)
+		if err != nil {
+			return fmt.Errorf("invalid segment %q: %v", part, err)
+		}
+		t.segments = append(t.segments, segment{kind: segmentLiteral, value: literal})
+	}
+	return nil
+}
+
+func isIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the template as it was written
+func (t *Template) String() string {
+	return t.raw
+}
+
+// FieldPaths returns the field paths bound by the template's variables, in order
+func (t *Template) FieldPaths() []string {
+	paths := make([]string, len(t.variables))
+	for i, v := range t.variables {
+		paths[i] = v.fieldPath
+	}
+	return paths
+}
+
+// Match matches an escaped URL path against the template, returning the unescaped value of each variable keyed by its field path
+// Variables spanning several segments keep their separators, with any escaped / inside a segment left escaped
+func (t *Template) Match(path string) (vars map[string]string, ok bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	path = path[1:]
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+	raw := strings.Split(path, "/")
+	if path == "" {
+		raw = nil
+	}
+	parts := make([]string, len(raw))
+	for i, part := range raw {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, false
+		}
+		parts[i] = unescaped
+	}
+	for i, seg := range t.segments {
+		switch seg.kind {
+		case segmentDeepWildcard:
+			if i > len(parts) {
+				return nil, false
+			}
+		case segmentWildcard:
+			if i >= len(parts) || parts[i] == "" {
+				return nil, false
+			}
+		case segmentLiteral:
+			if i >= len(parts) || parts[i] != seg.value {
+				return nil, false
+			}
+		}
+	}
+	last := t.segments[len(t.segments)-1]
+	if last.kind != segmentDeepWildcard && len(parts) != len(t.segments) {
+		return nil, false
+	}
+	vars = make(map[string]string, len(t.variables))
+	for _, v := range t.variables {
+		if v.end == v.start+1 {
+			vars[v.fieldPath] = parts[v.start]
+			continue
+		}
+		end := v.end
+		if end < 0 {
+			end = len(parts)
+		}
+		joined := make([]string, 0, end-v.start)
+		for _, part := range parts[v.start:end] {
+			joined = append(joined, strings.Replace(part, "/", "%2F", -1))
+		}
+		vars[v.fieldPath] = strings.Join(joined, "/")
+	}
+	return vars, true
+}
@@ -0,0 +1,71 @@
+package httprule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"/v1/photos/{photo_id}",
+		"/v1/{name=shelves/*/books/*}",
+		"/v1/{name=messages/**}",
+		"/v1/shelves/{shelf}:publish",
+		"/v1/*/files/**",
+		"/v1/{parent.id}/children",
+	}
+	for _, template := range valid {
+		_, err := Parse(template)
+		assert.NoError(t, err, template)
+	}
+	invalid := []string{
+		"",
+		"v1/photos",
+		"/",
+		"/v1//photos",
+		"/v1/photos/",
+		"/v1/{photo_id",
+		"/v1/{1photo}",
+		"/v1/**/photos",
+		"/v1/{a}/{a}",
+		"/v1/{a={b}}",
+		"/v1/photos:",
+	}
+	for _, template := range invalid {
+		_, err := Parse(template)
+		assert.Error(t, err, template)
+	}
+}
+
+func TestTemplate_Match(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		vars     map[string]string
+		ok       bool
+	}{
+		{template: "/v1/photos/{photo_id}", path: "/v1/photos/123", vars: map[string]string{"photo_id": "123"}, ok: true},
+		{template: "/v1/photos/{photo_id}", path: "/v1/photos/a%20b", vars: map[string]string{"photo_id": "a b"}, ok: true},
+		{template: "/v1/photos/{photo_id}", path: "/v1/photos", ok: false},
+		{template: "/v1/photos/{photo_id}", path: "/v1/photos/1/2", ok: false},
+		{template: "/v1/photos/{photo_id}", path: "/v1/albums/1", ok: false},
+		{template: "/v1/{name=shelves/*/books/*}", path: "/v1/shelves/s1/books/b%2F2", vars: map[string]string{"name": "shelves/s1/books/b%2F2"}, ok: true},
+		{template: "/v1/{name=messages/**}", path: "/v1/messages/a/b/c", vars: map[string]string{"name": "messages/a/b/c"}, ok: true},
+		{template: "/v1/{name=messages/**}", path: "/v1/messages", vars: map[string]string{"name": "messages"}, ok: true},
+		{template: "/v1/shelves/{shelf}:publish", path: "/v1/shelves/9:publish", vars: map[string]string{"shelf": "9"}, ok: true},
+		{template: "/v1/shelves/{shelf}:publish", path: "/v1/shelves/9", ok: false},
+		{template: "/v1/{parent.id}/children", path: "/v1/7/children", vars: map[string]string{"parent.id": "7"}, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template+" "+tt.path, func(t *testing.T) {
+			template, err := Parse(tt.template)
+			assert.NoError(t, err)
+			vars, ok := template.Match(tt.path)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.vars, vars)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter caps the number of concurrent holders. The cap may be changed at any time, a cap of zero or less is unlimited
+type Limiter struct {
+	mu      sync.Mutex
+	max     int
+	inUse   int
+	waiters []chan struct{}
+}
+
+// New creates a new Limiter allowing max concurrent holders
+func New(max int) *Limiter {
+	return &Limiter{max: max}
+}
+
+// Acquire takes a slot, waiting up to wait for one to become free. It returns false if no slot was acquired
+// Callers must call Release exactly once for every successful Acquire
+func (l *Limiter) Acquire(ctx context.Context, wait time.Duration) bool {
+	l.mu.Lock()
+	if l.hasRoom() {
+		l.inUse++
+		l.mu.Unlock()
+		return true
+	}
+	if wait <= 0 {
+		l.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, waiter := range l.waiters {
+		if waiter == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return false
+		}
+	}
+	// We were handed a slot while giving up, so give it back
+	l.inUse--
+	l.wake()
+	return false
+}
+
+// Release frees a slot taken by Acquire
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	l.wake()
+}
+
+// SetMax changes the cap, waking any waiters that now fit. Holders above a lowered cap keep their slots until released
+func (l *Limiter) SetMax(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = max
+	l.wake()
+}
+
+// Max returns the current cap
+func (l *Limiter) Max() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max
+}
+
+// InUse returns the number of slots currently held
+func (l *Limiter) InUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inUse
+}
+
+// hasRoom must be called with the lock held
+func (l *Limiter) hasRoom() bool {
+	return l.max <= 0 || l.inUse < l.max
+}
+
+// wake hands free slots to waiters in the order they arrived, it must be called with the lock held
+func (l *Limiter) wake() {
+	for len(l.waiters) > 0 && l.hasRoom() {
+		l.inUse++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// Group holds one Limiter per key, each using a default cap unless overridden
+// Limiters are only kept while they have holders or waiters, so arbitrary keys don't accumulate
+type Group struct {
+	mu        sync.Mutex
+	max       int
+	overrides map[string]int
+	entries   map[string]*groupEntry
+}
+
+type groupEntry struct {
+	limiter *Limiter
+	refs    int
+}
+
+// NewGroup creates a new Group whose limiters allow max concurrent holders by default
+func NewGroup(max int) *Group {
+	return &Group{
+		max:       max,
+		overrides: map[string]int{},
+		entries:   map[string]*groupEntry{},
+	}
+}
+
+// Acquire takes a slot for key, waiting up to wait for one to become free. It returns false if no slot was acquired
+// Callers must call Release with the same key exactly once for every successful Acquire
+func (g *Group) Acquire(ctx context.Context, key string, wait time.Duration) bool {
+	g.mu.Lock()
+	entry, exists := g.entries[key]
+	if !exists {
+		max, overridden := g.overrides[key]
+		if !overridden {
+			max = g.max
+		}
+		entry = &groupEntry{limiter: New(max)}
+		g.entries[key] = entry
+	}
+	entry.refs++
+	g.mu.Unlock()
+	acquired := entry.limiter.Acquire(ctx, wait)
+	if !acquired {
+		g.drop(key, entry)
+	}
+	return acquired
+}
+
+// Release frees a slot for key taken by Acquire
+func (g *Group) Release(key string) {
+	g.mu.Lock()
+	entry, exists := g.entries[key]
+	g.mu.Unlock()
+	if !exists {
+		return
+	}
+	entry.limiter.Release()
+	g.drop(key, entry)
+}
+
+// InUse returns the number of slots currently held for key
+func (g *Group) InUse(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, exists := g.entries[key]
+	if !exists {
+		return 0
+	}
+	return entry.limiter.InUse()
+}
+
+// SetDefault changes the cap of every key without an override
+func (g *Group) SetDefault(max int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.max = max
+	for key, entry := range g.entries {
+		if _, overridden := g.overrides[key]; !overridden {
+			entry.limiter.SetMax(max)
+		}
+	}
+}
+
+// Set overrides the cap for key
+func (g *Group) Set(key string, max int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.overrides[key] = max
+	if entry, exists := g.entries[key]; exists {
+		entry.limiter.SetMax(max)
+	}
+}
+
+// Unset removes the override for key, returning it to the default cap
+func (g *Group) Unset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.overrides, key)
+	if entry, exists := g.entries[key]; exists {
+		entry.limiter.SetMax(g.max)
+	}
+}
+
+func (g *Group) drop(key string, entry *groupEntry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry.refs--
+	if entry.refs <= 0 && g.entries[key] == entry {
+		delete(g.entries, key)
+	}
+}
@@ -0,0 +1,69 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := New(1)
+	t.Run("acquire within limit", func(t *testing.T) {
+		assert.True(t, l.Acquire(ctx, 0))
+		assert.Equal(t, 1, l.InUse())
+	})
+	t.Run("reject immediately", func(t *testing.T) {
+		assert.False(t, l.Acquire(ctx, 0))
+	})
+	t.Run("time out waiting", func(t *testing.T) {
+		assert.False(t, l.Acquire(ctx, time.Millisecond))
+		assert.Equal(t, 1, l.InUse())
+	})
+	t.Run("handed slot on release", func(t *testing.T) {
+		acquired := make(chan bool)
+		go func() {
+			acquired <- l.Acquire(ctx, time.Minute)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		l.Release()
+		assert.True(t, <-acquired)
+		assert.Equal(t, 1, l.InUse())
+	})
+	t.Run("raising the cap wakes waiters", func(t *testing.T) {
+		acquired := make(chan bool)
+		go func() {
+			acquired <- l.Acquire(ctx, time.Minute)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		l.SetMax(2)
+		assert.True(t, <-acquired)
+		assert.Equal(t, 2, l.InUse())
+	})
+	t.Run("unlimited", func(t *testing.T) {
+		l.SetMax(0)
+		assert.True(t, l.Acquire(ctx, 0))
+		assert.Equal(t, 3, l.InUse())
+	})
+}
+
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+	g := NewGroup(1)
+	g.Set("big", 2)
+	assert.True(t, g.Acquire(ctx, "small", 0))
+	assert.False(t, g.Acquire(ctx, "small", 0))
+	assert.True(t, g.Acquire(ctx, "big", 0))
+	assert.True(t, g.Acquire(ctx, "big", 0))
+	assert.False(t, g.Acquire(ctx, "big", 0))
+	g.SetDefault(2)
+	assert.True(t, g.Acquire(ctx, "small", 0))
+	assert.Equal(t, 2, g.InUse("small"))
+	g.Release("small")
+	g.Release("small")
+	assert.Equal(t, 0, g.InUse("small"))
+	assert.NotContains(t, g.entries, "small")
+	assert.Contains(t, g.entries, "big")
+}
@@ -15,6 +15,16 @@ func ProxyRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, p
 	convert.ProxyRequest(ctx, w, r, procedure, conn, txid, loggers...)
 }
 
+// ProxyBatch proxies a batch of unary calls, sent as a JSON array in a single HTTP request, through a GRPC connection compliant with mercury/proto
+func ProxyBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, conn *grpc.ClientConn, txid string, loggers ...logs.Writer) {
+	convert.ProxyBatch(ctx, w, r, conn, txid, loggers...)
+}
+
+// NewProxy creates a configurable proxy for HTTP requests, see convert.Proxy for the available options
+func NewProxy() *convert.Proxy {
+	return convert.NewProxy()
+}
+
 // NewServer creates a new server to convert mercury/proto messages to service-specific messages
 func NewServer(api, server interface{}, listener *grpc.Server, bypassInterceptors bool) (*proxy.Server, error) {
 	s, err := proxy.NewServer(api, server, listener, bypassInterceptors)
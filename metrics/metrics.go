@@ -0,0 +1,18 @@
+package metrics
+
+// Recorder receives metrics from mercury
+type Recorder interface {
+	// Count adds delta to the counter called name
+	Count(name string, delta int64, tags map[string]string)
+	// Gauge sets the current value of the gauge called name
+	Gauge(name string, value float64, tags map[string]string)
+}
+
+// NoopRecorder discards all metrics
+type NoopRecorder struct{}
+
+// Count ...
+func (n NoopRecorder) Count(name string, delta int64, tags map[string]string) {}
+
+// Gauge ...
+func (n NoopRecorder) Gauge(name string, value float64, tags map[string]string) {}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/protobuf/proto"
+)
+
+// allowedMethods lists the HTTP methods procName can be called with, including the HEAD and OPTIONS methods mercury provides automatically, or nil if procName doesn't exist
+func (s *Server) allowedMethods(procName string) []string {
+	api := s.getAPI()
+	defined := map[string]bool{}
+	for method, procedures := range api {
+		if _, found := procedures[procName]; found {
+			defined[method] = true
+		}
+	}
+	if len(defined) == 0 {
+		return nil
+	}
+	if defined["GET"] {
+		defined["HEAD"] = true
+	}
+	defined["OPTIONS"] = true
+	allowed := []string{}
+	for _, method := range httpStrings {
+		if defined[method] {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// automaticMethod handles requests for procedures which exist but don't define the requested HTTP method.
+// OPTIONS requests are answered with the Allow header, HEAD requests are converted to GET requests with head set so the caller can discard the body, and anything else gets 405 Method Not Allowed.
+// call is nil when res has already been decided
+func (s *Server) automaticMethod(req *httpapi.Request) (call *httpapi.Request, res *httpapi.Response, head bool) {
+	methodString, err := methodToString(req.GetMethod())
+	if err != nil {
+		return req, nil, false
+	}
+	if _, defined := s.getAPI()[methodString][req.GetProcedure()]; defined {
+		return req, nil, false
+	}
+	allowed := s.allowedMethods(req.GetProcedure())
+	if allowed == nil {
+		// Let the usual lookup report the procedure is unimplemented
+		return req, nil, false
+	}
+	allow := map[string]*httpapi.MultiVal{
+		"Allow": {Values: []string{strings.Join(allowed, ", ")}},
+	}
+	switch req.GetMethod() {
+	case httpapi.Method_OPTIONS:
+		return nil, &httpapi.Response{StatusCode: http.StatusNoContent, WriteHeaders: allow}, false
+	case httpapi.Method_HEAD:
+		if _, hasGet := s.getAPI()["GET"][req.GetProcedure()]; hasGet {
+			call = proto.Clone(req).(*httpapi.Request)
+			call.Method = httpapi.Method_GET
+			return call, nil, true
+		}
+	}
+	return nil, &httpapi.Response{
+		StatusCode:   http.StatusMethodNotAllowed,
+		Payload:      []byte(fmt.Sprintf("mercury: procedure %s does not support %s", req.GetProcedure(), methodString)),
+		WriteHeaders: allow,
+	}, false
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_automaticMethod(t *testing.T) {
+	s := &Server{
+		api: map[string]map[string]apiMethod{
+			"GET":    {"Photo": {pattern: apiMethodPatternStructStruct}},
+			"DELETE": {"Photo": {pattern: apiMethodPatternStructStruct}},
+			"POST":   {"Upload": {pattern: apiMethodPatternStructStruct}},
+		},
+	}
+	assert.Equal(t, []string{"GET", "HEAD", "DELETE", "OPTIONS"}, s.allowedMethods("Photo"))
+	assert.Equal(t, []string{"POST", "OPTIONS"}, s.allowedMethods("Upload"))
+	assert.Nil(t, s.allowedMethods("Missing"))
+	t.Run("defined method", func(t *testing.T) {
+		req := &httpapi.Request{Method: httpapi.Method_DELETE, Procedure: "Photo"}
+		call, res, head := s.automaticMethod(req)
+		assert.Equal(t, req, call)
+		assert.Nil(t, res)
+		assert.False(t, head)
+	})
+	t.Run("options", func(t *testing.T) {
+		res, err := s.ProxyUnary(context.Background(), &httpapi.Request{Method: httpapi.Method_OPTIONS, Procedure: "Photo"})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(http.StatusNoContent), res.GetStatusCode())
+		assert.Equal(t, []string{"GET, HEAD, DELETE, OPTIONS"}, res.GetWriteHeaders()["Allow"].GetValues())
+	})
+	t.Run("head", func(t *testing.T) {
+		req := &httpapi.Request{Method: httpapi.Method_HEAD, Procedure: "Photo"}
+		call, res, head := s.automaticMethod(req)
+		assert.Nil(t, res)
+		assert.True(t, head)
+		assert.Equal(t, httpapi.Method_GET, call.GetMethod())
+		assert.Equal(t, httpapi.Method_HEAD, req.GetMethod())
+	})
+	t.Run("wrong method", func(t *testing.T) {
+		_, res, _ := s.automaticMethod(&httpapi.Request{Method: httpapi.Method_HEAD, Procedure: "Upload"})
+		assert.Equal(t, uint32(http.StatusMethodNotAllowed), res.GetStatusCode())
+		assert.Equal(t, []string{"POST, OPTIONS"}, res.GetWriteHeaders()["Allow"].GetValues())
+		assert.Equal(t, "mercury: procedure Upload does not support HEAD", string(res.GetPayload()))
+	})
+	t.Run("missing procedure", func(t *testing.T) {
+		req := &httpapi.Request{Method: httpapi.Method_GET, Procedure: "Missing"}
+		call, res, _ := s.automaticMethod(req)
+		assert.Equal(t, req, call)
+		assert.Nil(t, res)
+	})
+}
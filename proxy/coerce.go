@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// coerceParam converts a query param or path variable to the JSON value protojson expects for field, returning InvalidArgument naming fieldPath if it doesn't fit
+func coerceParam(field protoreflect.FieldDescriptor, fieldPath, value string) (interface{}, error) {
+	coerced, err := coerceValue(field, value)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "mercury: invalid value %q for field %s: %v", value, fieldPath, err)
+	}
+	return coerced, nil
+}
+
+func coerceValue(field protoreflect.FieldDescriptor, value string) (interface{}, error) {
+	if field.IsMap() {
+		return nil, fmt.Errorf("map fields cannot be set from a string")
+	}
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected a bool")
+		}
+		return parsed, nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("expected a 32-bit integer")
+		}
+		return parsed, nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("expected an unsigned 32-bit integer")
+		}
+		return parsed, nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// protojson represents 64-bit integers as strings, so only check the value fits
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("expected a 64-bit integer")
+		}
+		return value, nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("expected an unsigned 64-bit integer")
+		}
+		return value, nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		switch value {
+		case "NaN", "Infinity", "-Infinity":
+			return value, nil
+		}
+		bitSize := 64
+		if field.Kind() == protoreflect.FloatKind {
+			bitSize = 32
+		}
+		parsed, err := strconv.ParseFloat(value, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number")
+		}
+		return parsed, nil
+	case protoreflect.EnumKind:
+		values := field.Enum().Values()
+		if number, err := strconv.ParseInt(value, 10, 32); err == nil {
+			if values.ByNumber(protoreflect.EnumNumber(number)) == nil && field.Enum().FullName() != "google.protobuf.NullValue" {
+				return nil, fmt.Errorf("%d is not a value of %s", number, field.Enum().FullName())
+			}
+			return number, nil
+		}
+		if values.ByName(protoreflect.Name(value)) == nil {
+			return nil, fmt.Errorf("expected a value of %s", field.Enum().FullName())
+		}
+		return value, nil
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return value, nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return coerceWellKnown(field.Message(), value)
+	}
+	return nil, fmt.Errorf("unsupported field type %s", field.Kind())
+}
+
+// coerceWellKnown converts a string to the JSON form of the well-known types which have a scalar JSON representation
+func coerceWellKnown(message protoreflect.MessageDescriptor, value string) (interface{}, error) {
+	switch message.FullName() {
+	case "google.protobuf.Timestamp":
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			return nil, fmt.Errorf("expected an RFC 3339 timestamp")
+		}
+		return value, nil
+	case "google.protobuf.Duration":
+		if !strings.HasSuffix(value, "s") {
+			return nil, fmt.Errorf("expected a duration in seconds, e.g. 1.5s")
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSuffix(value, "s"), 64); err != nil {
+			return nil, fmt.Errorf("expected a duration in seconds, e.g. 1.5s")
+		}
+		return value, nil
+	case "google.protobuf.FieldMask", "google.protobuf.Value":
+		return value, nil
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return coerceValue(message.Fields().ByName("value"), value)
+	}
+	return nil, fmt.Errorf("%s messages cannot be set from a string, set their fields instead", message.FullName())
+}
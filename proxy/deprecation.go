@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/deprecation"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/logs"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// deprecationHeaders returns the response metadata announcing the deprecation of a method marked with option deprecated = true or (mercury.deprecation.sunset), or nil if it isn't deprecated.
+// Deprecation follows RFC 9745, Sunset follows RFC 8594 and the successor is linked with rel="successor-version"
+func deprecationHeaders(method protoreflect.MethodDescriptor) (metadata.MD, error) {
+	if method == nil {
+		return nil, nil
+	}
+	options, _ := method.Options().(*descriptorpb.MethodOptions)
+	if options == nil {
+		return nil, nil
+	}
+	sunset, _ := proto.GetExtension(options, deprecation.E_Sunset).(*deprecation.Sunset)
+	if !options.GetDeprecated() && sunset == nil {
+		return nil, nil
+	}
+	md := metadata.MD{}
+	switch {
+	case sunset.GetSince() != "":
+		since, err := parseDate(sunset.GetSince())
+		if err != nil {
+			return nil, fmt.Errorf("%s has an invalid deprecation date: %v", method.FullName(), err)
+		}
+		md.Set("deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+	case options.GetDeprecated():
+		// Without a date, the value from earlier drafts of RFC 9745 is still understood by most clients
+		md.Set("deprecation", "true")
+	}
+	if sunset.GetDate() != "" {
+		date, err := parseDate(sunset.GetDate())
+		if err != nil {
+			return nil, fmt.Errorf("%s has an invalid sunset date: %v", method.FullName(), err)
+		}
+		md.Set("sunset", date.UTC().Format(http.TimeFormat))
+	}
+	if sunset.GetSuccessor() != "" {
+		md.Set("link", "<"+sunset.GetSuccessor()+`>; rel="successor-version"`)
+	}
+	return md, nil
+}
+
+// parseDate parses an RFC 3339 date, or date and time
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// announceDeprecation sends the deprecation headers of a deprecated procedure with setHeader, and logs the call so its remaining callers can be found
+func (s *Server) announceDeprecation(ctx context.Context, httpMethod httpapi.Method, procedure string, headers map[string]*httpapi.MultiVal, setHeader func(metadata.MD) error) {
+	methodString, err := methodToString(httpMethod)
+	if err != nil {
+		return
+	}
+	md := s.getAPI()[methodString][procedure].deprecation
+	if md == nil {
+		return
+	}
+	// This can only fail if there's no gRPC server to send headers to, in which case there's nobody to warn anyway
+	setHeader(md.Copy())
+	caller := "unknown client"
+	if agents := headers["User-Agent"].GetValues(); len(agents) > 0 {
+		caller = agents[0]
+	}
+	if forwarded := headers["X-Forwarded-For"].GetValues(); len(forwarded) > 0 {
+		caller += " for " + forwarded[0]
+	}
+	for _, logger := range s.getLoggers() {
+		logger.LogWarningf(txidFromContext(ctx), "mercury: deprecated procedure %s %s called by %s", methodString, procedure, caller)
+	}
+}
+
+// txidFromContext returns the transaction ID convert sent with the call, if there is one
+func txidFromContext(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(convert.TxidMetadata); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (s *Server) getLoggers() []logs.Writer {
+	if s == nil {
+		return defaultServer.loggers
+	}
+	return s.loggers
+}
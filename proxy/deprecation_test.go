@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/deprecation"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// recordingLogger records the warnings logged to it, and their transaction IDs
+type recordingLogger struct {
+	warnings []string
+	txids    []string
+}
+
+func (r *recordingLogger) LogTracef(txid string, format string, args ...interface{}) {}
+
+func (r *recordingLogger) LogWarningf(txid string, format string, args ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+	r.txids = append(r.txids, txid)
+}
+
+func (r *recordingLogger) LogErrorf(txid string, format string, args ...interface{}) {}
+
+// methodWithOptions builds the descriptor of a method with options
+func methodWithOptions(t *testing.T, options *descriptorpb.MethodOptions) protoreflect.MethodDescriptor {
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("photos_deprecation_test.proto"),
+		Package:    proto.String("photos"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Photos"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("GetPhoto"),
+				InputType:  proto.String(".google.protobuf.StringValue"),
+				OutputType: proto.String(".google.protobuf.StringValue"),
+				Options:    options,
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return file.Services().Get(0).Methods().Get(0)
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	withSunset := func(deprecated bool, sunset *deprecation.Sunset) *descriptorpb.MethodOptions {
+		options := &descriptorpb.MethodOptions{Deprecated: proto.Bool(deprecated)}
+		proto.SetExtension(options, deprecation.E_Sunset, sunset)
+		return options
+	}
+	tests := []struct {
+		name    string
+		options *descriptorpb.MethodOptions
+		want    metadata.MD
+		wantErr string
+	}{
+		{name: "no options"},
+		{name: "not deprecated", options: &descriptorpb.MethodOptions{Deprecated: proto.Bool(false)}},
+		{name: "deprecated", options: &descriptorpb.MethodOptions{Deprecated: proto.Bool(true)}, want: metadata.Pairs("deprecation", "true")},
+		{
+			name:    "sunset",
+			options: withSunset(true, &deprecation.Sunset{Since: proto.String("2020-12-01"), Date: proto.String("2021-06-30T12:00:00+10:00"), Successor: proto.String("/v2/photos")}),
+			want:    metadata.Pairs("deprecation", "@1606780800", "sunset", "Wed, 30 Jun 2021 02:00:00 GMT", "link", `</v2/photos>; rel="successor-version"`),
+		},
+		{
+			name:    "sunset without deprecated",
+			options: withSunset(false, &deprecation.Sunset{Date: proto.String("2021-06-30")}),
+			want:    metadata.Pairs("sunset", "Wed, 30 Jun 2021 00:00:00 GMT"),
+		},
+		{
+			name:    "invalid date",
+			options: withSunset(true, &deprecation.Sunset{Date: proto.String("next tuesday")}),
+			wantErr: "photos.Photos.GetPhoto has an invalid sunset date",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := deprecationHeaders(methodWithOptions(t, tt.options))
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	got, err := deprecationHeaders(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestServer_announceDeprecation(t *testing.T) {
+	logger := &recordingLogger{}
+	s := &Server{api: map[string]map[string]apiMethod{"GET": {
+		"OldPhoto": {deprecation: metadata.Pairs("deprecation", "true")},
+		"Photo":    {},
+	}}}
+	s.SetLoggers(logger)
+	var sent []metadata.MD
+	setHeader := func(md metadata.MD) error {
+		sent = append(sent, md)
+		return nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(convert.TxidMetadata, "tx-1"))
+	s.announceDeprecation(ctx, httpapi.Method_GET, "Photo", nil, setHeader)
+	assert.Empty(t, sent)
+	assert.Empty(t, logger.warnings)
+	s.announceDeprecation(ctx, httpapi.Method_GET, "OldPhoto", map[string]*httpapi.MultiVal{
+		"User-Agent":      {Values: []string{"legacy-app/1.0"}},
+		"X-Forwarded-For": {Values: []string{"203.0.113.7"}},
+	}, setHeader)
+	assert.Equal(t, []metadata.MD{metadata.Pairs("deprecation", "true")}, sent)
+	assert.Equal(t, []string{"mercury: deprecated procedure GET OldPhoto called by legacy-app/1.0 for 203.0.113.7"}, logger.warnings)
+	assert.Equal(t, []string{"tx-1"}, logger.txids)
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/url"
+	"reflect"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Download describes how a server-streaming procedure is served as a chunked HTTP download, see convert.Proxy.SetDownloadProcedures
+type Download struct {
+	// ChunkField is the bytes field of the response messages holding each chunk
+	ChunkField string
+	// ContentType is the Content-Type of the download, defaults to application/octet-stream
+	ContentType string
+	// Filename, if set, is sent in a Content-Disposition header so browsers save the download under that name
+	Filename string
+}
+
+// SetDownload allows a server-streaming procedure to be served as a chunked HTTP download, writing the ChunkField of each response message in turn.
+// Procedures which stream google.api.HttpBody can be downloaded without calling SetDownload, using the content_type of the first message
+func (s *Server) SetDownload(procedure string, download Download) {
+	if s.downloads == nil {
+		s.downloads = map[string]Download{}
+	}
+	s.downloads[procedure] = download
+}
+
+func (s *Server) getDownload(procedure string) (Download, bool) {
+	downloads := defaultServer.downloads
+	if s != nil {
+		downloads = s.downloads
+	}
+	download, found := downloads[procedure]
+	return download, found
+}
+
+// isDownload is true if convert asked for the stream to be served as a download
+func isDownload(init *httpapi.RoutingInformation) bool {
+	_, found := init.GetHeaders()[convert.DownloadHeader]
+	return found
+}
+
+// One struct in, raw chunks out. The request is built from the query string and path like a unary GET rather than received as a message
+func (s *Server) handleDownload(ctx context.Context, init *httpapi.RoutingInformation, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec) (err error) {
+	procedure := init.GetProcedure()
+	recvMethod, found := procType.Out(0).MethodByName("Recv")
+	if !found {
+		return status.Errorf(codes.Internal, "mercury: %s has no response stream", procedure)
+	}
+	responseMessage, ok := reflect.New(recvMethod.Type.Out(0).Elem()).Interface().(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "mercury: %s does not stream proto messages", procedure)
+	}
+	download, found := s.getDownload(procedure)
+	if !found && !isHTTPBody(responseMessage.ProtoReflect().Descriptor()) {
+		return status.Errorf(codes.Unimplemented, "mercury: %s cannot be downloaded", procedure)
+	}
+	if !found {
+		download.ChunkField = "data"
+	}
+	chunkField := resolveField(responseMessage.ProtoReflect().Descriptor(), []string{download.ChunkField})
+	if chunkField == nil || chunkField.Kind() != protoreflect.BytesKind || chunkField.IsList() {
+		return status.Errorf(codes.Internal, "mercury: %s has no bytes field %s to download", procedure, download.ChunkField)
+	}
+	request := reflect.New(procType.In(1).Elem()).Interface().(proto.Message)
+	if err = s.parseRoutedRequest(init, convert.DownloadHeader, request, codec); err != nil {
+		return err
+	}
+	if err = s.validate(ctx, procedure, request); err != nil {
+		return err
+	}
+	returnValues := caller.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(request)})
+	if returnValues[1].CanInterface() {
+		err, _ = returnValues[1].Interface().(error)
+	}
+	if err != nil {
+		if _, isStatus := status.FromError(err); !isStatus {
+			err = status.Errorf(codes.Internal, "non-gRPC error returned when initiating stream: %v", err)
+		}
+		return err
+	}
+	endpoint := returnValues[0]
+	if _, ok := endpoint.Interface().(grpc.ClientStream); !ok {
+		return status.Errorf(codes.Internal, "response message could not be converted to grpc.ServerStream interface")
+	}
+	recv := endpoint.MethodByName("Recv")
+	res, err := wrapRecv(recv)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	contentType := download.ContentType
+	if !found && res != nil {
+		contentType = res.ProtoReflect().Get(res.ProtoReflect().Descriptor().Fields().ByName("content_type")).String()
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	md := metadata.Pairs(convert.ContentTypeMetadata, contentType)
+	if download.Filename != "" {
+		md.Set("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": download.Filename}))
+	}
+	if err = srv.SendHeader(md); err != nil {
+		return err
+	}
+	for err == nil {
+		err = srv.Send(&httpapi.StreamedResponse{
+			Response: res.ProtoReflect().Get(chunkField).Bytes(),
+		})
+		if err != nil {
+			break
+		}
+		res, err = wrapRecv(recv)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// parseRoutedRequest fills request from the query string convert sent in queryHeader and the path, as ProxyUnary would for a request without a body
+func (s *Server) parseRoutedRequest(init *httpapi.RoutingInformation, queryHeader string, request proto.Message, codec codec) error {
+	params := url.Values{}
+	if query := init.GetHeaders()[queryHeader].GetValues(); len(query) > 0 {
+		var err error
+		params, err = url.ParseQuery(query[0])
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "mercury: invalid query string: %v", err)
+		}
+	}
+	req := &httpapi.Request{
+		Method:    init.GetMethod(),
+		Procedure: init.GetProcedure(),
+		Headers:   init.GetHeaders(),
+		Params:    map[string]*httpapi.MultiVal{},
+	}
+	for name, values := range params {
+		if name == fieldsParam {
+			// The fields param selects response fields, it isn't part of the request
+			continue
+		}
+		req.Params[name] = &httpapi.MultiVal{Values: values}
+	}
+	inputJSON, err := parseRequest(req, s.findBindings(init.GetMethod(), init.GetProcedure()), request.ProtoReflect().Descriptor(), s.getJSONQueryParams())
+	if _, isStatus := status.FromError(err); err != nil && !isStatus {
+		err = status.Errorf(codes.Internal, "mercury: %v", err)
+	}
+	if err != nil || len(inputJSON) == 0 {
+		return err
+	}
+	if err = codec.unmarshaller.Unmarshal(inputJSON, request); err != nil {
+		return status.Errorf(codes.InvalidArgument, "mercury: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeProxyStream records the header and responses sent by the proxy
+type fakeProxyStream struct {
+	httpapi.ExposedService_ProxyStreamServer
+	header metadata.MD
+	sent   [][]byte
+}
+
+func (f *fakeProxyStream) SendHeader(md metadata.MD) error {
+	f.header = md
+	return nil
+}
+
+func (f *fakeProxyStream) Send(res *httpapi.StreamedResponse) error {
+	f.sent = append(f.sent, res.GetResponse())
+	return nil
+}
+
+// fakeExportStream replies with messages, then io.EOF
+type fakeExportStream struct {
+	grpc.ClientStream
+	messages []*httpbody.HttpBody
+}
+
+func (f *fakeExportStream) Recv() (*httpbody.HttpBody, error) {
+	if len(f.messages) == 0 {
+		return nil, io.EOF
+	}
+	msg := f.messages[0]
+	f.messages = f.messages[1:]
+	return msg, nil
+}
+
+type exportStream interface {
+	grpc.ClientStream
+	Recv() (*httpbody.HttpBody, error)
+}
+
+type bytesStream interface {
+	grpc.ClientStream
+	Recv() (*wrapperspb.BytesValue, error)
+}
+
+// fakeBytesStream replies with chunks, then io.EOF
+type fakeBytesStream struct {
+	grpc.ClientStream
+	chunks []string
+}
+
+func (f *fakeBytesStream) Recv() (*wrapperspb.BytesValue, error) {
+	if len(f.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := f.chunks[0]
+	f.chunks = f.chunks[1:]
+	return wrapperspb.Bytes([]byte(chunk)), nil
+}
+
+func TestServer_handleDownload(t *testing.T) {
+	init := &httpapi.RoutingInformation{
+		Method:    httpapi.Method_GET,
+		Procedure: "GetExport",
+		Headers:   map[string]*httpapi.MultiVal{convert.DownloadHeader: {Values: []string{"content_type=text%2Fcsv"}}},
+	}
+	t.Run("HttpBody", func(t *testing.T) {
+		var received *httpbody.HttpBody
+		export := func(ctx context.Context, req *httpbody.HttpBody) (exportStream, error) {
+			received = req
+			return &fakeExportStream{messages: []*httpbody.HttpBody{
+				{ContentType: req.GetContentType(), Data: []byte("id,name\n")},
+				{Data: []byte("1,cat\n")},
+			}}, nil
+		}
+		s := &Server{}
+		srv := &fakeProxyStream{}
+		err := s.handleDownload(context.Background(), init, reflect.TypeOf(export), reflect.ValueOf(export), srv, s.codecFor("GetExport", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "text/csv", received.GetContentType())
+		assert.Equal(t, []string{"text/csv"}, srv.header.Get(convert.ContentTypeMetadata))
+		assert.Equal(t, [][]byte{[]byte("id,name\n"), []byte("1,cat\n")}, srv.sent)
+	})
+	t.Run("chunk field", func(t *testing.T) {
+		var export func(ctx context.Context, req *httpbody.HttpBody) (bytesStream, error)
+		export = func(ctx context.Context, req *httpbody.HttpBody) (bytesStream, error) {
+			return &fakeBytesStream{chunks: []string{"abc", "def"}}, nil
+		}
+		s := &Server{}
+		download := func() (*fakeProxyStream, error) {
+			srv := &fakeProxyStream{}
+			err := s.handleDownload(context.Background(), init, reflect.TypeOf(export), reflect.ValueOf(export), srv, s.codecFor("GetExport", nil))
+			return srv, err
+		}
+		_, err := download()
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+		s.SetDownload("GetExport", Download{ChunkField: "missing"})
+		_, err = download()
+		assert.Equal(t, codes.Internal, status.Code(err))
+		s.SetDownload("GetExport", Download{ChunkField: "value", Filename: "export.bin"})
+		srv, err := download()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"application/octet-stream"}, srv.header.Get(convert.ContentTypeMetadata))
+		assert.Equal(t, []string{"attachment; filename=export.bin"}, srv.header.Get("content-disposition"))
+		assert.Equal(t, [][]byte{[]byte("abc"), []byte("def")}, srv.sent)
+		export = func(ctx context.Context, req *httpbody.HttpBody) (bytesStream, error) {
+			return nil, status.Error(codes.NotFound, "no such export")
+		}
+		_, err = download()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// fieldsParam is the query param which selects the fields of partial responses, like fields=items(id,name),next_page_token
+const fieldsParam = "fields"
+
+// fieldTree is the set of fields selected in a message, a nil subtree selects the whole field
+type fieldTree map[protoreflect.Name]fieldTree
+
+// takeFields removes the fields param from req so it isn't set on the request message, and returns its value
+func takeFields(req *httpapi.Request) (*httpapi.Request, string) {
+	values, found := req.GetParams()[fieldsParam]
+	if !found {
+		return req, ""
+	}
+	// The request belongs to the caller, so the params are replaced rather than changed
+	stripped := proto.Clone(req).(*httpapi.Request)
+	delete(stripped.Params, fieldsParam)
+	return stripped, strings.Join(values.GetValues(), ",")
+}
+
+// streamFields returns the fields param of a stream, which convert sends in convert.FieldsHeader for websockets and in the query string of uploads
+func streamFields(init *httpapi.RoutingInformation) string {
+	headers := init.GetHeaders()
+	if values := headers[convert.FieldsHeader].GetValues(); len(values) > 0 {
+		return strings.Join(values, ",")
+	}
+	if query := headers[convert.UploadHeader].GetValues(); len(query) > 0 {
+		// An invalid query string is reported when the request is parsed
+		params, _ := url.ParseQuery(query[0])
+		return strings.Join(params[fieldsParam], ",")
+	}
+	return ""
+}
+
+// responseDescriptor returns the descriptor of the response messages of a procedure of any pattern, or nil if they aren't proto messages
+func responseDescriptor(procType reflect.Type) protoreflect.MessageDescriptor {
+	if procType.NumOut() < 1 {
+		return nil
+	}
+	out := procType.Out(0)
+	for _, name := range []string{"Recv", "CloseAndRecv"} {
+		if method, found := out.MethodByName(name); found && method.Type.NumOut() == 2 {
+			out = method.Type.Out(0)
+			break
+		}
+	}
+	if out.Kind() != reflect.Ptr {
+		return nil
+	}
+	message, ok := reflect.New(out.Elem()).Interface().(proto.Message)
+	if !ok {
+		return nil
+	}
+	return message.ProtoReflect().Descriptor()
+}
+
+// withFields returns c set to prune responses to the fields in selector, or InvalidArgument if selector doesn't describe fields of message
+func (c codec) withFields(selector string, message protoreflect.MessageDescriptor) (codec, error) {
+	if selector == "" {
+		return c, nil
+	}
+	invalid := func(err error) (codec, error) {
+		return c, status.Errorf(codes.InvalidArgument, "mercury: invalid fields parameter %q: %v", selector, err)
+	}
+	if message == nil {
+		return invalid(fmt.Errorf("the response is not a proto message"))
+	}
+	paths, err := parseFieldSelector(selector)
+	if err != nil {
+		return invalid(err)
+	}
+	mask := &fieldmaskpb.FieldMask{}
+	for _, path := range paths {
+		canonical, err := canonicalFieldPath(message, path)
+		if err != nil {
+			return invalid(err)
+		}
+		mask.Paths = append(mask.Paths, canonical)
+	}
+	mask.Normalize()
+	c.fields = mask
+	return c, nil
+}
+
+// parseFieldSelector converts a selector like items(id,name),next_page_token to the field paths it selects, like items.id, items.name and next_page_token
+func parseFieldSelector(selector string) ([]string, error) {
+	var paths []string
+	rest, err := parseFieldSelection(selector, "", &paths)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected )")
+	}
+	return paths, nil
+}
+
+// parseFieldSelection reads comma separated fields until the end of the selector or a closing bracket, appending the path of each to paths, and returns the rest of the selector
+func parseFieldSelection(selector, prefix string, paths *[]string) (string, error) {
+	for {
+		end := strings.IndexAny(selector, ",()")
+		if end < 0 {
+			end = len(selector)
+		}
+		name := strings.TrimSpace(selector[:end])
+		if name == "" {
+			return "", fmt.Errorf("empty field name")
+		}
+		// Sub-fields may also be selected with a/b, as Google APIs do
+		path := prefix + strings.Replace(name, "/", ".", -1)
+		selector = selector[end:]
+		if strings.HasPrefix(selector, "(") {
+			var err error
+			selector, err = parseFieldSelection(selector[1:], path+".", paths)
+			if err != nil {
+				return "", err
+			}
+			if !strings.HasPrefix(selector, ")") {
+				return "", fmt.Errorf("missing ) after %s", path)
+			}
+			selector = selector[1:]
+		} else {
+			*paths = append(*paths, path)
+		}
+		if selector == "" || selector[0] == ')' {
+			return selector, nil
+		}
+		if selector[0] != ',' {
+			return "", fmt.Errorf("expected , after %s", path)
+		}
+		selector = selector[1:]
+	}
+}
+
+// canonicalFieldPath checks a dotted path refers to a field of message, descending through repeated and map fields, and returns it with proto field names
+func canonicalFieldPath(message protoreflect.MessageDescriptor, path string) (string, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		if message == nil {
+			return "", fmt.Errorf("%s has no fields", strings.Join(names[:i], "."))
+		}
+		field := message.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			field = message.Fields().ByJSONName(name)
+		}
+		if field == nil {
+			return "", fmt.Errorf("%s has no field %s", message.FullName(), name)
+		}
+		names[i] = string(field.Name())
+		message = selectableMessage(field)
+	}
+	return strings.Join(names, "."), nil
+}
+
+// selectableMessage returns the message whose fields can be selected within a field, which is the element or value type of repeated and map fields
+func selectableMessage(field protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if field.IsMap() {
+		field = field.MapValue()
+	}
+	if field.Kind() != protoreflect.MessageKind && field.Kind() != protoreflect.GroupKind {
+		return nil
+	}
+	return field.Message()
+}
+
+// maskTree arranges the paths of a normalised field mask by message
+func maskTree(mask *fieldmaskpb.FieldMask) fieldTree {
+	tree := fieldTree{}
+	for _, path := range mask.GetPaths() {
+		names := strings.Split(path, ".")
+		node := tree
+		for _, name := range names[:len(names)-1] {
+			child := node[protoreflect.Name(name)]
+			if child == nil {
+				child = fieldTree{}
+				node[protoreflect.Name(name)] = child
+			}
+			node = child
+		}
+		node[protoreflect.Name(names[len(names)-1])] = nil
+	}
+	return tree
+}
+
+// marshal converts a response message to JSON, keeping only the fields selected by the fields param if there was one
+func (c codec) marshal(message proto.Message) ([]byte, error) {
+	if c.fields == nil {
+		return c.marshaller.Marshal(message)
+	}
+	tree := maskTree(c.fields)
+	// The procedure may still hold the response, so a copy is pruned
+	pruned := proto.Clone(message)
+	pruneMessage(pruned.ProtoReflect(), tree)
+	data, err := c.marshaller.Marshal(pruned)
+	if err != nil || !c.marshaller.EmitUnpopulated {
+		return data, err
+	}
+	// Emitting unpopulated fields brings back everything that was pruned, so it's removed from the JSON as well
+	return filterJSON(data, pruned.ProtoReflect().Descriptor(), tree)
+}
+
+// pruneMessage clears every field of message which isn't in tree
+func pruneMessage(message protoreflect.Message, tree fieldTree) {
+	var unselected []protoreflect.FieldDescriptor
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		subtree, selected := tree[field.Name()]
+		switch {
+		case !selected:
+			unselected = append(unselected, field)
+		case subtree == nil:
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				pruneMessage(list.Get(i).Message(), subtree)
+			}
+		case field.IsMap():
+			value.Map().Range(func(_ protoreflect.MapKey, element protoreflect.Value) bool {
+				pruneMessage(element.Message(), subtree)
+				return true
+			})
+		default:
+			pruneMessage(value.Message(), subtree)
+		}
+		return true
+	})
+	for _, field := range unselected {
+		message.Clear(field)
+	}
+}
+
+// filterJSON removes the fields which aren't in tree from the JSON of a message
+func filterJSON(data []byte, message protoreflect.MessageDescriptor, tree fieldTree) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers are kept exactly as protojson wrote them
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	filterValue(value, message, tree)
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+func filterValue(value interface{}, message protoreflect.MessageDescriptor, tree fieldTree) {
+	object, isObject := value.(map[string]interface{})
+	if !isObject || message == nil {
+		return
+	}
+	for key, child := range object {
+		field := message.Fields().ByJSONName(key)
+		if field == nil {
+			field = message.Fields().ByName(protoreflect.Name(key))
+		}
+		if field == nil {
+			// Keys like the @type of an Any aren't fields
+			continue
+		}
+		subtree, selected := tree[field.Name()]
+		switch {
+		case !selected:
+			delete(object, key)
+		case subtree == nil:
+		case field.IsList():
+			elements, _ := child.([]interface{})
+			for _, element := range elements {
+				filterValue(element, selectableMessage(field), subtree)
+			}
+		case field.IsMap():
+			elements, _ := child.(map[string]interface{})
+			for _, element := range elements {
+				filterValue(element, selectableMessage(field), subtree)
+			}
+		default:
+			filterValue(child, selectableMessage(field), subtree)
+		}
+	}
+}
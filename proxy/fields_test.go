@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestParseFieldSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []string
+		wantErr  string
+	}{
+		{selector: "name", want: []string{"name"}},
+		{selector: "items(id,name),next_page_token", want: []string{"items.id", "items.name", "next_page_token"}},
+		{selector: "a(b(c,d),e/f), g.h", want: []string{"a.b.c", "a.b.d", "a.e.f", "g.h"}},
+		{selector: "a,,b", wantErr: "empty field name"},
+		{selector: "a(b", wantErr: "missing ) after a"},
+		{selector: "a)", wantErr: "unexpected )"},
+		{selector: "a(b)c", wantErr: "expected , after a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			got, err := parseFieldSelector(tt.selector)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCodec_marshal(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("photos.proto"),
+		Package: proto.String("photos"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Photo"), Field: []*descriptorpb.FieldDescriptorProto{{Name: proto.String("id"), Number: proto.Int32(1)}}},
+			{Name: proto.String("Album")},
+		},
+	}
+	message := file.ProtoReflect().Descriptor()
+	t.Run("emit unpopulated", func(t *testing.T) {
+		codec, err := MarshalOptions{}.codec().withFields("messageType(name,field(number)),package", message)
+		assert.NoError(t, err)
+		got, err := codec.marshal(file)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"package":"photos","messageType":[{"name":"Photo","field":[{"number":1}]},{"name":"Album","field":[]}]}`, string(got))
+		// The response itself is left alone
+		assert.Equal(t, "photos.proto", file.GetName())
+	})
+	t.Run("omit unpopulated", func(t *testing.T) {
+		codec, err := MarshalOptions{OmitUnpopulated: true, UseProtoNames: true}.codec().withFields("message_type/name", message)
+		assert.NoError(t, err)
+		got, err := codec.marshal(file)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"message_type":[{"name":"Photo"},{"name":"Album"}]}`, string(got))
+	})
+	t.Run("no selector", func(t *testing.T) {
+		codec, err := MarshalOptions{OmitUnpopulated: true}.codec().withFields("", message)
+		assert.NoError(t, err)
+		got, err := codec.marshal(file)
+		assert.NoError(t, err)
+		assert.Contains(t, string(got), `"name":"photos.proto"`)
+	})
+	for _, selector := range []string{"missing", "name(length)", "messageType(", "messageType(missing)"} {
+		t.Run("invalid "+selector, func(t *testing.T) {
+			_, err := MarshalOptions{}.codec().withFields(selector, message)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestTakeFields(t *testing.T) {
+	req := &httpapi.Request{Params: map[string]*httpapi.MultiVal{
+		"fields": {Values: []string{"name", "package"}},
+		"id":     {Values: []string{"1"}},
+	}}
+	stripped, selector := takeFields(req)
+	assert.Equal(t, "name,package", selector)
+	assert.NotContains(t, stripped.GetParams(), "fields")
+	assert.Contains(t, stripped.GetParams(), "id")
+	assert.Contains(t, req.GetParams(), "fields")
+	unchanged, selector := takeFields(&httpapi.Request{})
+	assert.Empty(t, selector)
+	assert.NotNil(t, unchanged)
+}
+
+func TestStreamFields(t *testing.T) {
+	assert.Equal(t, "name", streamFields(&httpapi.RoutingInformation{Headers: map[string]*httpapi.MultiVal{convert.FieldsHeader: {Values: []string{"name"}}}}))
+	assert.Equal(t, "id,size", streamFields(&httpapi.RoutingInformation{Headers: map[string]*httpapi.MultiVal{convert.UploadHeader: {Values: []string{"album=1&fields=id,size"}}}}))
+	assert.Empty(t, streamFields(&httpapi.RoutingInformation{}))
+}
+
+func TestResponseDescriptor(t *testing.T) {
+	unary := func(ctx context.Context, req *descriptorpb.FileDescriptorProto) (*descriptorpb.DescriptorProto, error) {
+		return nil, nil
+	}
+	server := func(ctx context.Context, req *descriptorpb.FileDescriptorProto) (bytesStream, error) { return nil, nil }
+	client := func(ctx context.Context) (uploadStream, error) { return nil, nil }
+	assert.Equal(t, (&descriptorpb.DescriptorProto{}).ProtoReflect().Descriptor(), responseDescriptor(reflect.TypeOf(unary)))
+	assert.Equal(t, (&wrapperspb.BytesValue{}).ProtoReflect().Descriptor(), responseDescriptor(reflect.TypeOf(server)))
+	assert.Equal(t, (&wrapperspb.Int64Value{}).ProtoReflect().Descriptor(), responseDescriptor(reflect.TypeOf(client)))
+	assert.Nil(t, responseDescriptor(reflect.TypeOf(func() {})))
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/url"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// formContentType is the media type of bodies submitted by plain HTML forms
+	formContentType = "application/x-www-form-urlencoded"
+	// multipartContentType is the media type of bodies submitted by HTML forms with file inputs and browser FormData uploads
+	multipartContentType = "multipart/form-data"
+)
+
+// bodyMediaType returns the media type and parameters of the request's Content-Type header
+func bodyMediaType(req *httpapi.Request) (string, map[string]string) {
+	values := req.GetHeaders()["Content-Type"].GetValues()
+	if len(values) == 0 {
+		return "", nil
+	}
+	mediaType, params, err := mime.ParseMediaType(values[0])
+	if err != nil {
+		return "", nil
+	}
+	return mediaType, params
+}
+
+// isForm is true for requests with an application/x-www-form-urlencoded body
+func isForm(req *httpapi.Request) bool {
+	mediaType, _ := bodyMediaType(req)
+	return mediaType == formContentType
+}
+
+// isMultipart is true for requests with a multipart/form-data body
+func isMultipart(req *httpapi.Request) bool {
+	mediaType, _ := bodyMediaType(req)
+	return mediaType == multipartContentType
+}
+
+// formBodyJSON converts a form body to JSON the same way as query params, so dotted keys populate nested messages, repeated keys populate repeated fields and values are coerced to the types of the fields in message
+func formBodyJSON(payload []byte, message protoreflect.MessageDescriptor, jsonParams bool) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(string(payload))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "mercury: invalid form body: %v", err)
+	}
+	return valuesJSON(values, message, jsonParams)
+}
+
+// multipartBodyJSON converts a multipart/form-data body to JSON like a form body, with the raw contents of file parts filling bytes fields
+func multipartBodyJSON(req *httpapi.Request, message protoreflect.MessageDescriptor, jsonParams bool) ([]byte, error) {
+	if len(req.GetPayload()) == 0 {
+		return nil, nil
+	}
+	invalid := func(err error) ([]byte, error) {
+		return nil, status.Errorf(codes.InvalidArgument, "mercury: invalid multipart body: %v", err)
+	}
+	_, params := bodyMediaType(req)
+	reader := multipart.NewReader(bytes.NewReader(req.GetPayload()), params["boundary"])
+	values := url.Values{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return invalid(err)
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return invalid(err)
+		}
+		value := string(data)
+		if part.FileName() != "" {
+			// The values are converted like query params, which give bytes fields as base64
+			value = base64.StdEncoding.EncodeToString(data)
+		}
+		values.Add(part.FormName(), value)
+	}
+	return valuesJSON(values, message, jsonParams)
+}
+
+// valuesJSON converts the values of a form body to JSON the same way as query params
+func valuesJSON(values url.Values, message protoreflect.MessageDescriptor, jsonParams bool) ([]byte, error) {
+	form := make(map[string]*httpapi.MultiVal, len(values))
+	for key, vals := range values {
+		form[key] = &httpapi.MultiVal{Values: vals}
+	}
+	formMap, err := parseQuery(form, message, jsonParams)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(formMap)
+}
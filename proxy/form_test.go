@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestParseRequest_Form(t *testing.T) {
+	message := (&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Descriptor()
+	newRequest := func(payload string) *httpapi.Request {
+		return &httpapi.Request{
+			Method:  httpapi.Method_POST,
+			Headers: map[string]*httpapi.MultiVal{"Content-Type": {Values: []string{"application/x-www-form-urlencoded; charset=utf-8"}}},
+			Params:  map[string]*httpapi.MultiVal{"name": {Values: []string{"from_query"}}, "json_name": {Values: []string{"fromQuery"}}},
+			Payload: []byte(payload),
+		}
+	}
+	t.Run("fields", func(t *testing.T) {
+		got, err := parseRequest(newRequest("name=from_form&number=5&label=LABEL_REPEATED&options.packed=true&options.uninterpretedOption.identifierValue=x+y"), nil, message, false)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"from_form","json_name":"fromQuery","number":5,"label":"LABEL_REPEATED","options":{"packed":true,"uninterpretedOption":{"identifierValue":"x y"}}}`, string(got))
+	})
+	t.Run("repeated", func(t *testing.T) {
+		files := (&descriptorpb.FileDescriptorProto{}).ProtoReflect().Descriptor()
+		req := newRequest("dependency=a.proto&dependency=b.proto&public_dependency=1")
+		req.Params = nil
+		got, err := parseRequest(req, nil, files, false)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"dependency":["a.proto","b.proto"],"public_dependency":[1]}`, string(got))
+	})
+	t.Run("body field", func(t *testing.T) {
+		template, err := httprule.Parse("/v1/fields/{name}")
+		assert.NoError(t, err)
+		bindings := []httprule.Binding{{Method: "POST", Template: template, Body: "options"}}
+		req := newRequest("packed=false&lazy=true")
+		req.Params = nil
+		req.Headers[convert.PathHeader] = &httpapi.MultiVal{Values: []string{"/v1/fields/size"}}
+		got, err := parseRequest(req, bindings, message, false)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"size","options":{"packed":false,"lazy":true}}`, string(got))
+	})
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := parseRequest(newRequest("number=five"), nil, message, false)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("malformed", func(t *testing.T) {
+		_, err := parseRequest(newRequest("name=%zz"), nil, message, false)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestParseRequest_Multipart(t *testing.T) {
+	message := (&descriptorpb.UninterpretedOption{}).ProtoReflect().Descriptor()
+	newRequest := func(build func(form *multipart.Writer)) *httpapi.Request {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		build(form)
+		form.Close()
+		return &httpapi.Request{
+			Method:  httpapi.Method_POST,
+			Headers: map[string]*httpapi.MultiVal{"Content-Type": {Values: []string{form.FormDataContentType()}}},
+			Params:  map[string]*httpapi.MultiVal{"identifier_value": {Values: []string{"from_query"}}, "double_value": {Values: []string{"1.5"}}},
+			Payload: body.Bytes(),
+		}
+	}
+	t.Run("files and fields", func(t *testing.T) {
+		got, err := parseRequest(newRequest(func(form *multipart.Writer) {
+			form.WriteField("identifier_value", "from_form")
+			form.WriteField("positiveIntValue", "5")
+			file, _ := form.CreateFormFile("string_value", "cat.jpg")
+			file.Write([]byte("not really a jpeg"))
+		}), nil, message, false)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"identifier_value":"from_form","positiveIntValue":"5","double_value":1.5,"string_value":"bm90IHJlYWxseSBhIGpwZWc="}`, string(got))
+	})
+	t.Run("malformed", func(t *testing.T) {
+		req := newRequest(func(form *multipart.Writer) {})
+		req.Payload = []byte("garbage")
+		_, err := parseRequest(req, nil, message, false)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// httpBodyName is the message which carries raw request and response bodies instead of JSON
+const httpBodyName protoreflect.FullName = "google.api.HttpBody"
+
+func isHTTPBody(message protoreflect.MessageDescriptor) bool {
+	return message != nil && message.FullName() == httpBodyName
+}
+
+// rawBodyJSON wraps a raw request body and its Content-Type in the JSON form of google.api.HttpBody
+func rawBodyJSON(req *httpapi.Request) ([]byte, error) {
+	body := &httpbody.HttpBody{
+		Data: req.GetPayload(),
+	}
+	if values := req.GetHeaders()["Content-Type"].GetValues(); len(values) > 0 {
+		body.ContentType = values[0]
+	}
+	return protojson.Marshal(body)
+}
+
+// rawResponse returns the data and content type of a google.api.HttpBody response, which is written as it is rather than as JSON
+func rawResponse(message proto.Message) (data []byte, contentType string, isRaw bool) {
+	reflected := message.ProtoReflect()
+	if !isHTTPBody(reflected.Descriptor()) {
+		return nil, "", false
+	}
+	fields := reflected.Descriptor().Fields()
+	data = reflected.Get(fields.ByName("data")).Bytes()
+	contentType = reflected.Get(fields.ByName("content_type")).String()
+	return data, contentType, true
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type rawService struct{}
+
+func (rawService) Echo(ctx context.Context, req *httpbody.HttpBody) (*httpbody.HttpBody, error) {
+	if req.GetContentType() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no content type")
+	}
+	return &httpbody.HttpBody{ContentType: req.GetContentType(), Data: req.GetData()}, nil
+}
+
+func TestServer_HttpBody(t *testing.T) {
+	method := reflect.TypeOf(rawService{}).Method(0)
+	s := &Server{}
+	call := func(contentType string, payload []byte) (*httpapi.Response, error) {
+		req := &httpapi.Request{
+			Method:  httpapi.Method_POST,
+			Payload: payload,
+			Headers: map[string]*httpapi.MultiVal{"Content-Type": {Values: []string{contentType}}},
+		}
+		inputJSON, err := parseRequest(req, nil, requestDescriptor(method.Type), false)
+		if !assert.NoError(t, err) {
+			return nil, err
+		}
+		return s.callStructStruct(context.Background(), &httpapi.Request{Procedure: "Echo"}, inputJSON, method.Type, reflect.ValueOf(rawService{}).Method(0), s.codecFor("Echo", nil))
+	}
+	t.Run("raw body in and out", func(t *testing.T) {
+		res, err := call("text/csv", []byte("id,name\n1,cat\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(http.StatusOK), res.GetStatusCode())
+		assert.Equal(t, "id,name\n1,cat\n", string(res.GetPayload()))
+		assert.Equal(t, []string{"text/csv"}, res.GetWriteHeaders()["Content-Type"].GetValues())
+	})
+	t.Run("JSON-like bodies aren't treated as empty", func(t *testing.T) {
+		res, err := call("application/json", []byte("{}"))
+		assert.NoError(t, err)
+		assert.Equal(t, "{}", string(res.GetPayload()))
+	})
+	t.Run("errors", func(t *testing.T) {
+		res, err := call("", []byte("data"))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Empty(t, res.GetWriteHeaders())
+	})
+}
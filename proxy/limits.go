@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LLKennedy/mercury/internal/limit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ConcurrencyLimits configures the maximum number of concurrent ProxyUnary calls and ProxyStream streams the Server handles
+type ConcurrencyLimits struct {
+	// PerProcedure caps concurrent calls to each procedure, zero is unlimited. Individual procedures may be overridden with SetProcedureConcurrencyLimit
+	PerProcedure int
+	// Total caps concurrent calls across all procedures, zero is unlimited
+	Total int
+	// QueueTimeout is how long a call may wait for a free slot before being rejected with Unavailable, zero rejects excess calls immediately
+	QueueTimeout time.Duration
+	// RetryAfter is sent with rejections as a retry-after header and a google.rpc.RetryInfo detail, which convert turns into a Retry-After header. Defaults to 1 second
+	RetryAfter time.Duration
+}
+
+type serverLimits struct {
+	procedures *limit.Group
+	total      *limit.Limiter
+	mu         sync.Mutex
+	wait       time.Duration
+	retryAfter time.Duration
+}
+
+// SetConcurrencyLimits enables or adjusts concurrency limits, it is safe to call again while serving requests
+func (s *Server) SetConcurrencyLimits(limits ConcurrencyLimits) {
+	l := s.initLimits()
+	l.procedures.SetDefault(limits.PerProcedure)
+	l.total.SetMax(limits.Total)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.wait = limits.QueueTimeout
+	l.retryAfter = limits.RetryAfter
+	if l.retryAfter <= 0 {
+		l.retryAfter = time.Second
+	}
+}
+
+// SetProcedureConcurrencyLimit overrides the concurrency limit for a single procedure, zero is unlimited
+func (s *Server) SetProcedureConcurrencyLimit(procedure string, max int) {
+	s.initLimits().procedures.Set(procedure, max)
+}
+
+// initLimits creates the limits on first use, calls already in flight go on without them
+func (s *Server) initLimits() *serverLimits {
+	s.limitsOnce.Do(func() {
+		s.limits.Store(&serverLimits{
+			procedures: limit.NewGroup(0),
+			total:      limit.New(0),
+			retryAfter: time.Second,
+		})
+	})
+	return s.getLimits()
+}
+
+func (s *Server) getLimits() *serverLimits {
+	if s == nil {
+		s = defaultServer
+	}
+	l, _ := s.limits.Load().(*serverLimits)
+	return l
+}
+
+// acquireSlots returns an Unavailable error if the procedure or server is at capacity, otherwise it returns a function to release the slots
+func (s *Server) acquireSlots(ctx context.Context, procedure string) (release func(), err error) {
+	l := s.getLimits()
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	wait, retryAfter := l.wait, l.retryAfter
+	l.mu.Unlock()
+	deadline := time.Now().Add(wait)
+	if !l.procedures.Acquire(ctx, procedure, wait) {
+		return nil, shed(ctx, retryAfter, fmt.Sprintf("mercury: procedure %s is at its concurrency limit", procedure))
+	}
+	if !l.total.Acquire(ctx, time.Until(deadline)) {
+		l.procedures.Release(procedure)
+		return nil, shed(ctx, retryAfter, "mercury: server is at its concurrency limit")
+	}
+	return func() {
+		l.total.Release()
+		l.procedures.Release(procedure)
+	}, nil
+}
+
+// shed returns an Unavailable error telling the client when to retry, in a RetryInfo detail and a retry-after header
+func shed(ctx context.Context, retryAfter time.Duration, message string) error {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	// This can only fail if ctx doesn't come from a gRPC server, in which case there's nobody to send headers to anyway
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+	errStatus := status.New(codes.Unavailable, message)
+	if withDetails, err := errStatus.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		errStatus = withDetails
+	}
+	return errStatus.Err()
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServer_acquireSlots(t *testing.T) {
+	ctx := context.Background()
+	t.Run("no limits", func(t *testing.T) {
+		s := &Server{}
+		release, err := s.acquireSlots(ctx, "Thing")
+		assert.NoError(t, err)
+		release()
+	})
+	t.Run("per procedure", func(t *testing.T) {
+		s := &Server{}
+		s.SetConcurrencyLimits(ConcurrencyLimits{PerProcedure: 1})
+		release, err := s.acquireSlots(ctx, "Thing")
+		assert.NoError(t, err)
+		_, err = s.acquireSlots(ctx, "Thing")
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		otherRelease, err := s.acquireSlots(ctx, "Other")
+		assert.NoError(t, err)
+		otherRelease()
+		release()
+		release, err = s.acquireSlots(ctx, "Thing")
+		assert.NoError(t, err)
+		release()
+	})
+	t.Run("override and total", func(t *testing.T) {
+		s := &Server{}
+		s.SetConcurrencyLimits(ConcurrencyLimits{PerProcedure: 1, Total: 2})
+		s.SetProcedureConcurrencyLimit("Thing", 3)
+		first, err := s.acquireSlots(ctx, "Thing")
+		assert.NoError(t, err)
+		second, err := s.acquireSlots(ctx, "Thing")
+		assert.NoError(t, err)
+		_, err = s.acquireSlots(ctx, "Thing")
+		assert.EqualError(t, err, status.Error(codes.Unavailable, "mercury: server is at its concurrency limit").Error())
+		first()
+		second()
+	})
+	t.Run("retry after", func(t *testing.T) {
+		s := &Server{}
+		s.SetConcurrencyLimits(ConcurrencyLimits{Total: 1, RetryAfter: 5 * time.Second})
+		release, err := s.acquireSlots(ctx, "Thing")
+		assert.NoError(t, err)
+		_, err = s.acquireSlots(ctx, "Thing")
+		if details := status.Convert(err).Details(); assert.Len(t, details, 1) {
+			assert.Equal(t, 5*time.Second, details[0].(*errdetails.RetryInfo).GetRetryDelay().AsDuration())
+		}
+		release()
+	})
+	t.Run("set while serving", func(t *testing.T) {
+		s := &Server{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				if release, err := s.acquireSlots(ctx, "Thing"); err == nil {
+					release()
+				}
+			}
+		}()
+		s.SetConcurrencyLimits(ConcurrencyLimits{PerProcedure: 1})
+		<-done
+	})
+}
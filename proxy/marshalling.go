@@ -1,12 +1,140 @@
 package proxy
 
-import "google.golang.org/protobuf/encoding/protojson"
+import (
+	"mime"
+	"strings"
+	"sync"
 
-var unmarshaller = protojson.UnmarshalOptions{
-	AllowPartial:   true,
-	DiscardUnknown: true,
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// MarshalOptions configures how request and response messages are converted to and from JSON.
+// The zero value gives mercury's defaults: lowerCamelCase field names, enum value names, unpopulated fields emitted and unknown fields discarded
+type MarshalOptions struct {
+	// UseProtoNames uses the proto field names in responses instead of lowerCamelCase JSON names. Requests accept either regardless
+	UseProtoNames bool
+	// UseEnumNumbers writes enums as numbers instead of value names in responses
+	UseEnumNumbers bool
+	// OmitUnpopulated leaves fields with default values out of responses
+	OmitUnpopulated bool
+	// RejectUnknown rejects requests containing fields the request message doesn't have with InvalidArgument
+	RejectUnknown bool
+}
+
+// codec holds the protojson options used for a single call
+type codec struct {
+	marshaller   protojson.MarshalOptions
+	unmarshaller protojson.UnmarshalOptions
+	// fields selects the fields kept in responses, see withFields
+	fields *fieldmaskpb.FieldMask
+}
+
+func (o MarshalOptions) codec() codec {
+	return codec{
+		marshaller: protojson.MarshalOptions{
+			AllowPartial:    true,
+			UseProtoNames:   o.UseProtoNames,
+			UseEnumNumbers:  o.UseEnumNumbers,
+			EmitUnpopulated: !o.OmitUnpopulated,
+		},
+		unmarshaller: protojson.UnmarshalOptions{
+			AllowPartial:   true,
+			DiscardUnknown: !o.RejectUnknown,
+		},
+	}
+}
+
+// negotiate overrides options with any parameters on the request's application/json Accept media type.
+// For example, Accept: application/json; names=proto; enums=numbers; unpopulated=omit; unknown=reject
+func (o MarshalOptions) negotiate(headers map[string]*httpapi.MultiVal) MarshalOptions {
+	for _, header := range headers["Accept"].GetValues() {
+		for _, mediaRange := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil || mediaType != "application/json" {
+				continue
+			}
+			switch params["names"] {
+			case "proto":
+				o.UseProtoNames = true
+			case "json":
+				o.UseProtoNames = false
+			}
+			switch params["enums"] {
+			case "numbers":
+				o.UseEnumNumbers = true
+			case "names":
+				o.UseEnumNumbers = false
+			}
+			switch params["unpopulated"] {
+			case "omit":
+				o.OmitUnpopulated = true
+			case "emit":
+				o.OmitUnpopulated = false
+			}
+			switch params["unknown"] {
+			case "reject":
+				o.RejectUnknown = true
+			case "discard":
+				o.RejectUnknown = false
+			}
+			return o
+		}
+	}
+	return o
+}
+
+type serverMarshalling struct {
+	mu         sync.RWMutex
+	defaults   MarshalOptions
+	procedures map[string]MarshalOptions
 }
-var marshaller = protojson.MarshalOptions{
-	AllowPartial:    true,
-	EmitUnpopulated: true,
+
+// SetMarshalOptions sets the JSON options used for every procedure without its own options, it is safe to call again while serving requests
+func (s *Server) SetMarshalOptions(options MarshalOptions) {
+	m := s.initMarshalling()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaults = options
+}
+
+// SetProcedureMarshalOptions replaces the JSON options for a single procedure, it is safe to call again while serving requests
+func (s *Server) SetProcedureMarshalOptions(procedure string, options MarshalOptions) {
+	m := s.initMarshalling()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.procedures[procedure] = options
+}
+
+// initMarshalling creates the option set the first time any options are configured, until then every call uses the protojson defaults
+func (s *Server) initMarshalling() *serverMarshalling {
+	s.marshallingOnce.Do(func() {
+		s.marshalling.Store(&serverMarshalling{
+			procedures: map[string]MarshalOptions{},
+		})
+	})
+	return s.getMarshalling()
+}
+
+func (s *Server) getMarshalling() *serverMarshalling {
+	if s == nil {
+		s = defaultServer
+	}
+	m, _ := s.marshalling.Load().(*serverMarshalling)
+	return m
+}
+
+// codecFor returns the JSON options for a call to procedure, in order of precedence from the request's Accept header, the procedure's options and the server's options
+func (s *Server) codecFor(procedure string, headers map[string]*httpapi.MultiVal) codec {
+	options := MarshalOptions{}
+	if m := s.getMarshalling(); m != nil {
+		m.mu.RLock()
+		options = m.defaults
+		if procedureOptions, found := m.procedures[procedure]; found {
+			options = procedureOptions
+		}
+		m.mu.RUnlock()
+	}
+	return options.negotiate(headers).codec()
 }
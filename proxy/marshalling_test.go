@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestServer_codecFor(t *testing.T) {
+	message := &descriptorpb.FieldDescriptorProto{
+		JsonName: proto.String("photoId"),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+	}
+	accept := func(value string) map[string]*httpapi.MultiVal {
+		return map[string]*httpapi.MultiVal{"Accept": {Values: []string{value}}}
+	}
+	s := &Server{}
+	t.Run("defaults", func(t *testing.T) {
+		codec := s.codecFor("Photo", nil)
+		assert.True(t, codec.marshaller.EmitUnpopulated)
+		assert.True(t, codec.unmarshaller.DiscardUnknown)
+		out, err := codec.marshaller.Marshal(message)
+		assert.NoError(t, err)
+		assert.Contains(t, string(out), `"jsonName":"photoId"`)
+		assert.Contains(t, string(out), `"label":"LABEL_REPEATED"`)
+	})
+	s.SetMarshalOptions(MarshalOptions{UseProtoNames: true, OmitUnpopulated: true})
+	s.SetProcedureMarshalOptions("Strict", MarshalOptions{RejectUnknown: true})
+	t.Run("server", func(t *testing.T) {
+		out, err := s.codecFor("Photo", nil).marshaller.Marshal(message)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"json_name":"photoId","label":"LABEL_REPEATED"}`, string(out))
+	})
+	t.Run("procedure", func(t *testing.T) {
+		codec := s.codecFor("Strict", nil)
+		assert.False(t, codec.marshaller.UseProtoNames)
+		assert.False(t, codec.unmarshaller.DiscardUnknown)
+		assert.Error(t, codec.unmarshaller.Unmarshal([]byte(`{"unknown":1}`), &descriptorpb.FieldDescriptorProto{}))
+	})
+	t.Run("accept", func(t *testing.T) {
+		out, err := s.codecFor("Photo", accept("text/html, application/json; names=json; enums=numbers")).marshaller.Marshal(message)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"jsonName":"photoId","label":3}`, string(out))
+		codec := s.codecFor("Strict", accept("application/json;unknown=discard;unpopulated=omit"))
+		assert.True(t, codec.unmarshaller.DiscardUnknown)
+		assert.False(t, codec.marshaller.EmitUnpopulated)
+	})
+	t.Run("set while serving", func(t *testing.T) {
+		s := &Server{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				s.codecFor("Photo", nil)
+			}
+		}()
+		s.SetMarshalOptions(MarshalOptions{UseProtoNames: true})
+		<-done
+		assert.True(t, s.codecFor("Photo", nil).marshaller.UseProtoNames)
+	})
+}
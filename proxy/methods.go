@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 func validateMethod(apiMethod reflect.Method, serverType reflect.Type) (methodType string, procedureName string, pattern apiMethodPattern, err error) {
@@ -73,3 +78,81 @@ func stripInsensitive(methodName, httpType string) string {
 	}
 	return methodName[len(httpType):]
 }
+
+// findMethod looks up the descriptor for an api method by its service and method name, returning nil if it can't be found.
+// The service is named by api, the Unimplemented<ServiceName>Server struct, and the request message tells apart services with the same name in different packages
+func findMethod(api reflect.Type, apiMethod reflect.Method, pattern apiMethodPattern) protoreflect.MethodDescriptor {
+	service := serviceName(api)
+	input := requestMessage(apiMethod.Type, pattern)
+	var method protoreflect.MethodDescriptor
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len() && method == nil; i++ {
+			if service != "" && string(services.Get(i).Name()) != service {
+				continue
+			}
+			candidate := services.Get(i).Methods().ByName(protoreflect.Name(apiMethod.Name))
+			if candidate != nil && (input == nil || candidate.Input().FullName() == input.FullName()) {
+				method = candidate
+			}
+		}
+		return method == nil
+	})
+	return method
+}
+
+// serviceName returns the name of the service whose Unimplemented<ServiceName>Server struct is api, or an empty string if api isn't named that way
+func serviceName(api reflect.Type) string {
+	if api.Kind() == reflect.Ptr {
+		api = api.Elem()
+	}
+	name := api.Name()
+	if !strings.HasPrefix(name, "Unimplemented") || !strings.HasSuffix(name, "Server") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, "Unimplemented"), "Server")
+}
+
+// requestMessage returns the descriptor of the request messages of an api method of any pattern, or nil if they aren't proto messages
+func requestMessage(methodType reflect.Type, pattern apiMethodPattern) protoreflect.MessageDescriptor {
+	var in reflect.Type
+	switch pattern {
+	case apiMethodPatternStructStruct:
+		in = methodType.In(2)
+	case apiMethodPatternStructStream:
+		in = methodType.In(1)
+	case apiMethodPatternStreamStruct, apiMethodPatternStreamStream:
+		recv, found := methodType.In(1).MethodByName("Recv")
+		if !found || recv.Type.NumOut() != 2 {
+			return nil
+		}
+		in = recv.Type.Out(0)
+	default:
+		return nil
+	}
+	if in.Kind() != reflect.Ptr {
+		return nil
+	}
+	message, ok := reflect.New(in.Elem()).Interface().(proto.Message)
+	if !ok {
+		return nil
+	}
+	return message.ProtoReflect().Descriptor()
+}
+
+// findBindings returns the bindings from the google.api.http option of an api method's descriptor, every one of which must use the same HTTP method as the method name
+func findBindings(apiMethod reflect.Method, method protoreflect.MethodDescriptor, methodString string) ([]httprule.Binding, error) {
+	if method == nil {
+		return nil, nil
+	}
+	bindings, err := httprule.Bindings(method)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		if binding.Method != methodString {
+			return nil, fmt.Errorf("%s is bound to %s %s but begins with %s", apiMethod.Name, binding.Method, binding.Template, methodString)
+		}
+	}
+	return bindings, nil
+}
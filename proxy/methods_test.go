@@ -6,6 +6,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type exposedThingA struct{}
@@ -114,3 +121,100 @@ func Test_stripInsensitive(t *testing.T) {
 		})
 	}
 }
+
+type stringValueServerStream interface {
+	grpc.ServerStream
+	Send(*wrapperspb.StringValue) error
+}
+
+type stringValueClientStream interface {
+	grpc.ServerStream
+	Recv() (*wrapperspb.StringValue, error)
+	SendAndClose(*wrapperspb.StringValue) error
+}
+
+type stringValueStream interface {
+	grpc.ServerStream
+	Recv() (*wrapperspb.StringValue, error)
+	Send(*wrapperspb.StringValue) error
+}
+
+// UnimplementedEchoServer is named like generated code, so findMethod looks for the Echo service
+type UnimplementedEchoServer struct{}
+
+func (*UnimplementedEchoServer) GetEcho(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	return nil, nil
+}
+
+func (*UnimplementedEchoServer) GetEchoFeed(*wrapperspb.StringValue, stringValueServerStream) error {
+	return nil
+}
+
+func (*UnimplementedEchoServer) PostEchoUpload(stringValueClientStream) error {
+	return nil
+}
+
+func (*UnimplementedEchoServer) GetEchoChat(stringValueStream) error {
+	return nil
+}
+
+// registerEchoServices registers the Echo service, an Echo service in another package taking different messages and a service with the same methods under another name
+func registerEchoServices(t *testing.T) {
+	method := func(name, input string, clientStreaming, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(input),
+			OutputType:      proto.String(".google.protobuf.StringValue"),
+			ClientStreaming: proto.Bool(clientStreaming),
+			ServerStreaming: proto.Bool(serverStreaming),
+		}
+	}
+	for _, file := range []*descriptorpb.FileDescriptorProto{
+		{
+			Name:    proto.String("echo_other_test.proto"),
+			Package: proto.String("echo.other"),
+			Service: []*descriptorpb.ServiceDescriptorProto{
+				{Name: proto.String("Echo"), Method: []*descriptorpb.MethodDescriptorProto{method("GetEcho", ".google.protobuf.Int32Value", false, false)}},
+				{Name: proto.String("Parrot"), Method: []*descriptorpb.MethodDescriptorProto{method("GetEchoChat", ".google.protobuf.StringValue", true, true)}},
+			},
+		},
+		{
+			Name:    proto.String("echo_test.proto"),
+			Package: proto.String("echo"),
+			Service: []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Echo"), Method: []*descriptorpb.MethodDescriptorProto{
+				method("GetEcho", ".google.protobuf.StringValue", false, false),
+				method("GetEchoFeed", ".google.protobuf.StringValue", false, true),
+				method("PostEchoUpload", ".google.protobuf.StringValue", true, false),
+				method("GetEchoChat", ".google.protobuf.StringValue", true, true),
+			}}},
+		},
+	} {
+		file.Syntax = proto.String("proto3")
+		file.Dependency = []string{"google/protobuf/wrappers.proto"}
+		if _, err := protoregistry.GlobalFiles.FindFileByPath(file.GetName()); err == nil {
+			continue
+		}
+		descriptor, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+		if assert.NoError(t, err) {
+			assert.NoError(t, protoregistry.GlobalFiles.RegisterFile(descriptor))
+		}
+	}
+}
+
+func Test_findMethod(t *testing.T) {
+	registerEchoServices(t)
+	api := reflect.TypeOf(&UnimplementedEchoServer{})
+	for _, name := range []string{"GetEcho", "GetEchoFeed", "PostEchoUpload", "GetEchoChat"} {
+		t.Run(name, func(t *testing.T) {
+			apiMethod, _ := api.MethodByName(name)
+			method := findMethod(api, apiMethod, getPattern(apiMethod.Type))
+			if assert.NotNil(t, method) {
+				assert.Equal(t, protoreflect.FullName("echo.Echo."+name), method.FullName())
+			}
+		})
+	}
+	t.Run("unknown service", func(t *testing.T) {
+		apiMethod, _ := reflect.TypeOf(&exposedThingA{}).MethodByName("PostDoThing")
+		assert.Nil(t, findMethod(reflect.TypeOf(&exposedThingA{}), apiMethod, apiMethodPatternStructStruct))
+	})
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/url"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The fields of AIP-158 paginated List procedures
+const (
+	pageSizeField      protoreflect.Name = "page_size"
+	pageTokenField     protoreflect.Name = "page_token"
+	nextPageTokenField protoreflect.Name = "next_page_token"
+)
+
+// nextPageLink returns an RFC 8288 Link to the page after response, or "" if pagination links are disabled, the procedure doesn't follow AIP-158 or response is the last page.
+// The link repeats the request's path and params with page_token replaced, so it's relative to the URL the client requested
+func (s *Server) nextPageLink(req *httpapi.Request, request, response proto.Message) string {
+	if !s.getPaginationLinks() || req.GetMethod() != httpapi.Method_GET || request == nil || response == nil {
+		return ""
+	}
+	requestFields := request.ProtoReflect().Descriptor().Fields()
+	tokenField := requestFields.ByName(pageTokenField)
+	nextField := response.ProtoReflect().Descriptor().Fields().ByName(nextPageTokenField)
+	if !isStringField(tokenField) || !isIntField(requestFields.ByName(pageSizeField)) || !isStringField(nextField) {
+		return ""
+	}
+	next := response.ProtoReflect().Get(nextField).String()
+	if next == "" {
+		return ""
+	}
+	query := url.Values{}
+	for name, values := range req.GetParams() {
+		if name == string(tokenField.Name()) || name == tokenField.JSONName() {
+			continue
+		}
+		query[name] = values.GetValues()
+	}
+	query.Set(string(tokenField.Name()), next)
+	path := ""
+	if paths := req.GetHeaders()[convert.PathHeader].GetValues(); len(paths) > 0 {
+		path = paths[0]
+	}
+	return "<" + path + "?" + query.Encode() + `>; rel="next"`
+}
+
+func isStringField(field protoreflect.FieldDescriptor) bool {
+	return field != nil && !field.IsList() && field.Kind() == protoreflect.StringKind
+}
+
+func isIntField(field protoreflect.FieldDescriptor) bool {
+	if field == nil || field.IsList() {
+		return false
+	}
+	switch field.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind, protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/longrunning"
+)
+
+type listService struct{}
+
+func (listService) ListOperations(ctx context.Context, req *longrunning.ListOperationsRequest) (*longrunning.ListOperationsResponse, error) {
+	if req.GetPageToken() == "last" {
+		return &longrunning.ListOperationsResponse{}, nil
+	}
+	return &longrunning.ListOperationsResponse{NextPageToken: "next+page"}, nil
+}
+
+func TestServer_nextPageLink(t *testing.T) {
+	method := reflect.TypeOf(listService{}).Method(0)
+	s := &Server{}
+	call := func(httpMethod httpapi.Method, params map[string]*httpapi.MultiVal) *httpapi.Response {
+		req := &httpapi.Request{
+			Method:    httpMethod,
+			Procedure: "ListOperations",
+			Headers:   map[string]*httpapi.MultiVal{convert.PathHeader: {Values: []string{"/v1/operations"}}},
+			Params:    params,
+		}
+		inputJSON, err := parseRequest(req, nil, requestDescriptor(method.Type), false)
+		assert.NoError(t, err)
+		res, err := s.callStructStruct(context.Background(), req, inputJSON, method.Type, reflect.ValueOf(listService{}).Method(0), s.codecFor("ListOperations", nil))
+		assert.NoError(t, err)
+		return res
+	}
+	params := map[string]*httpapi.MultiVal{
+		"pageSize":  {Values: []string{"10"}},
+		"pageToken": {Values: []string{"first"}},
+		"fields":    {Values: []string{"operations(name),nextPageToken"}},
+	}
+	assert.Empty(t, call(httpapi.Method_GET, params).GetWriteHeaders()["Link"], "links are opt-in")
+	s.SetPaginationLinks(true)
+	assert.Equal(t, []string{`</v1/operations?fields=operations%28name%29%2CnextPageToken&pageSize=10&page_token=next%2Bpage>; rel="next"`}, call(httpapi.Method_GET, params).GetWriteHeaders()["Link"].GetValues())
+	assert.Empty(t, call(httpapi.Method_GET, map[string]*httpapi.MultiVal{"page_token": {Values: []string{"last"}}}).GetWriteHeaders()["Link"], "last page")
+	assert.Empty(t, call(httpapi.Method_POST, params).GetWriteHeaders()["Link"], "only GET")
+	assert.Empty(t, s.nextPageLink(&httpapi.Request{Method: httpapi.Method_GET}, &httpapi.Request{}, &httpapi.Response{}), "not paginated")
+}
@@ -3,22 +3,79 @@ package proxy
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/LLKennedy/mercury/convert"
 	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/httprule"
 	"github.com/peterbourgon/mergemap"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func parseQuery(query map[string]*httpapi.MultiVal) map[string]interface{} {
+// parseQuery converts query params to a JSON-ready map. Dotted keys like filter.owner.id populate nested messages, and repeated keys populate repeated fields.
+// Values for fields known to message are coerced to the JSON type protojson expects for them.
+// With jsonParams set, values which are JSON objects are decoded too, for compatibility with clients which send nested data that way
+func parseQuery(query map[string]*httpapi.MultiVal, message protoreflect.MessageDescriptor, jsonParams bool) (map[string]interface{}, error) {
 	js := map[string]interface{}{}
-	for key, value := range query {
-		// TODO: don't ignore/overwrite duplicate keys here
-		merged := ""
-		for _, merged = range value.GetValues() {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	// Sort the keys so overlapping params like filter and filter.id always resolve the same way
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := query[key].GetValues()
+		if len(values) == 0 {
+			continue
+		}
+		path := strings.Split(key, ".")
+		field := resolveField(message, path)
+		parsed := make([]interface{}, len(values))
+		for i, value := range values {
+			if jsonParams {
+				parsed[i] = parseQueryString(value)
+			} else {
+				parsed[i] = value
+			}
+			if str, isString := parsed[i].(string); isString && field != nil {
+				var err error
+				parsed[i], err = coerceParam(field, key, str)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if field != nil && field.IsList() || field == nil && len(parsed) > 1 {
+			setField(js, path, parsed)
+		} else {
+			setField(js, path, parsed[len(parsed)-1])
+		}
+	}
+	return js, nil
+}
+
+// resolveField finds the field a dotted path refers to in message, accepting both proto and JSON field names. It returns nil if message is nil or the path doesn't resolve
+func resolveField(message protoreflect.MessageDescriptor, path []string) protoreflect.FieldDescriptor {
+	var field protoreflect.FieldDescriptor
+	for _, name := range path {
+		if message == nil {
+			return nil
+		}
+		fields := message.Fields()
+		field = fields.ByName(protoreflect.Name(name))
+		if field == nil {
+			field = fields.ByJSONName(name)
+		}
+		if field == nil {
+			return nil
+		}
+		message = nil
+		if field.Kind() == protoreflect.MessageKind && !field.IsList() && !field.IsMap() {
+			message = field.Message()
 		}
-		parsed := parseQueryString(merged)
-		js[key] = parsed
 	}
-	return js
+	return field
 }
 
 func parseQueryString(part string) interface{} {
@@ -36,9 +93,37 @@ func parseQueryString(part string) interface{} {
 	return part
 }
 
-func parseRequest(req *httpapi.Request) (finalJSON []byte, err error) {
+func parseRequest(req *httpapi.Request, bindings []httprule.Binding, message protoreflect.MessageDescriptor, jsonParams bool) (finalJSON []byte, err error) {
 	// First we convert query parameters to a map
-	queryMap := parseQuery(req.GetParams())
+	queryMap, err := parseQuery(req.GetParams(), message, jsonParams)
+	if err != nil {
+		return
+	}
+	bodyJSON := req.GetPayload()
+	binding, vars, bound := matchBinding(req, bindings)
+	var patchPaths []string
+	var isPatch bool
+	if !bound || binding.Body != "" {
+		if body := bodyDescriptor(message, binding, bound); isHTTPBody(body) {
+			// The body is passed through as it is, whatever its content type
+			bodyJSON, err = rawBodyJSON(req)
+		} else if isForm(req) {
+			bodyJSON, err = formBodyJSON(bodyJSON, body, jsonParams)
+		} else if isMultipart(req) {
+			bodyJSON, err = multipartBodyJSON(req, body, jsonParams)
+		} else {
+			bodyJSON, patchPaths, isPatch, err = preparePatch(req, bodyJSON, body)
+		}
+		if err != nil {
+			return
+		}
+	}
+	if bound {
+		bodyJSON, err = selectBody(bodyJSON, binding.Body)
+		if err != nil {
+			return
+		}
+	}
 	switch req.GetMethod() {
 	case httpapi.Method_CONNECT, httpapi.Method_GET, httpapi.Method_HEAD, httpapi.Method_OPTIONS, httpapi.Method_TRACE:
 		// No request body, only query params are possible
@@ -50,7 +135,6 @@ func parseRequest(req *httpapi.Request) (finalJSON []byte, err error) {
 		}
 	case httpapi.Method_DELETE, httpapi.Method_PATCH, httpapi.Method_POST, httpapi.Method_PUT:
 		// Merge request body with query params
-		bodyJSON := req.GetPayload()
 		if bodyJSON != nil && len(queryMap) > 0 {
 			var bodyMap map[string]interface{}
 			err = json.Unmarshal(bodyJSON, &bodyMap)
@@ -71,9 +155,136 @@ func parseRequest(req *httpapi.Request) (finalJSON []byte, err error) {
 		// It shouldn't be possible to hit this normally, we do validation before we reach this point
 		err = fmt.Errorf("invalid http method")
 	}
+	if err != nil {
+		return
+	}
+	if len(vars) > 0 {
+		// Path variables take precedence over both the body and query params
+		finalJSON, err = setPathVariables(finalJSON, vars, message)
+		if err != nil {
+			return
+		}
+	}
+	if isPatch {
+		finalJSON, err = setUpdateMask(finalJSON, patchPaths, message)
+	}
 	return
 }
 
+// matchBinding finds the google.api.http binding matching the path convert forwarded with the request, if there is one
+func matchBinding(req *httpapi.Request, bindings []httprule.Binding) (binding httprule.Binding, vars map[string]string, ok bool) {
+	if len(bindings) == 0 {
+		return
+	}
+	paths := req.GetHeaders()[convert.PathHeader].GetValues()
+	if len(paths) == 0 {
+		return
+	}
+	method, err := methodToString(req.GetMethod())
+	if err != nil {
+		return
+	}
+	return httprule.Match(bindings, method, paths[0])
+}
+
+// bodyDescriptor returns the descriptor of the message the request body is unmarshalled into, which is a field of the request if the binding selects one
+func bodyDescriptor(message protoreflect.MessageDescriptor, binding httprule.Binding, bound bool) protoreflect.MessageDescriptor {
+	if !bound || binding.Body == "*" {
+		return message
+	}
+	field := resolveField(message, strings.Split(binding.Body, "."))
+	if field == nil || field.Kind() != protoreflect.MessageKind {
+		return nil
+	}
+	return field.Message()
+}
+
+// selectBody maps the request body onto the field named by a binding's body selector
+func selectBody(bodyJSON []byte, selector string) ([]byte, error) {
+	switch {
+	case selector == "*" || len(bodyJSON) == 0:
+		return bodyJSON, nil
+	case selector == "":
+		// The binding doesn't accept a body, everything must come from the path and query params
+		return nil, nil
+	}
+	var body interface{}
+	err := json.Unmarshal(bodyJSON, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall request body JSON: %v", err)
+	}
+	wrapped := map[string]interface{}{}
+	setField(wrapped, strings.Split(selector, "."), body)
+	return json.Marshal(wrapped)
+}
+
+// setPathVariables sets the value of each field path in the request JSON, coercing them like query params
+func setPathVariables(requestJSON []byte, vars map[string]string, message protoreflect.MessageDescriptor) ([]byte, error) {
+	requestMap := map[string]interface{}{}
+	if len(requestJSON) > 0 {
+		err := json.Unmarshal(requestJSON, &requestMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshall request JSON: %v", err)
+		}
+	}
+	for fieldPath, value := range vars {
+		path := strings.Split(fieldPath, ".")
+		var coerced interface{} = value
+		if field := resolveField(message, path); field != nil {
+			var err error
+			coerced, err = coerceParam(field, fieldPath, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		setField(requestMap, path, coerced)
+	}
+	return json.Marshal(requestMap)
+}
+
+// setField sets the value at a field path, replacing anything in the way. Fields given by their JSON name are renamed to the proto name used in the path so protojson doesn't see them twice
+func setField(target map[string]interface{}, path []string, value interface{}) {
+	name := path[0]
+	if jsonName := jsonCamelCase(name); jsonName != name {
+		if existing, found := target[jsonName]; found {
+			delete(target, jsonName)
+			if _, alsoFound := target[name]; !alsoFound {
+				target[name] = existing
+			}
+		}
+	}
+	if len(path) == 1 {
+		target[name] = value
+		return
+	}
+	child, ok := target[name].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		target[name] = child
+	}
+	setField(child, path[1:], value)
+}
+
+// jsonCamelCase converts a proto field name to its default JSON name, the same way protoc does
+func jsonCamelCase(name string) string {
+	out := make([]byte, 0, len(name))
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			out = append(out, c-'a'+'A')
+			upper = false
+		default:
+			out = append(out, c)
+			upper = false
+		}
+	}
+	return string(out)
+}
+
 func methodToString(in httpapi.Method) (out string, err error) {
 	switch in {
 	case httpapi.Method_GET:
@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestParseRequest_Bindings(t *testing.T) {
+	newBinding := func(method, template, body string) httprule.Binding {
+		parsed, err := httprule.Parse(template)
+		assert.NoError(t, err)
+		return httprule.Binding{Method: method, Template: parsed, Body: body}
+	}
+	newRequest := func(method httpapi.Method, path string, payload string) *httpapi.Request {
+		req := &httpapi.Request{
+			Method:  method,
+			Headers: map[string]*httpapi.MultiVal{convert.PathHeader: {Values: []string{path}}},
+			Params:  map[string]*httpapi.MultiVal{"size": {Values: []string{"large"}}},
+		}
+		if payload != "" {
+			req.Payload = []byte(payload)
+		}
+		return req
+	}
+	tests := []struct {
+		name     string
+		req      *httpapi.Request
+		bindings []httprule.Binding
+		want     string
+	}{
+		{
+			name:     "path variable",
+			req:      newRequest(httpapi.Method_GET, "/v1/photos/123", ""),
+			bindings: []httprule.Binding{newBinding("GET", "/v1/photos/{photo_id}", "")},
+			want:     `{"photo_id":"123","size":"large"}`,
+		},
+		{
+			name:     "nested field path replaces JSON name",
+			req:      newRequest(httpapi.Method_POST, "/v1/albums/a1/photos", `{"album":{"albumId":"spoofed","title":"x"}}`),
+			bindings: []httprule.Binding{newBinding("POST", "/v1/albums/{album.album_id}/photos", "*")},
+			want:     `{"album":{"album_id":"a1","title":"x"},"size":"large"}`,
+		},
+		{
+			name:     "body field",
+			req:      newRequest(httpapi.Method_PUT, "/v1/photos/9", `{"title":"x"}`),
+			bindings: []httprule.Binding{newBinding("PUT", "/v1/photos/{photo_id}", "photo")},
+			want:     `{"photo":{"title":"x"},"photo_id":"9","size":"large"}`,
+		},
+		{
+			name:     "no body",
+			req:      newRequest(httpapi.Method_DELETE, "/v1/photos/9", `{"title":"x"}`),
+			bindings: []httprule.Binding{newBinding("DELETE", "/v1/photos/{photo_id}", "")},
+			want:     `{"photo_id":"9","size":"large"}`,
+		},
+		{
+			name:     "unmatched path falls back",
+			req:      newRequest(httpapi.Method_GET, "/Photo", ""),
+			bindings: []httprule.Binding{newBinding("GET", "/v1/photos/{photo_id}", "")},
+			want:     `{"size":"large"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRequest(tt.req, tt.bindings, nil, false)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	query := map[string]*httpapi.MultiVal{
+		"name":                {Values: []string{"first", "second"}},
+		"dependency":          {Values: []string{"a.proto"}},
+		"options.javaPackage": {Values: []string{"com.example"}},
+		"options.go_package":  {Values: []string{`{"not":"decoded"}`}},
+		"unknown":             {Values: []string{"x", "y"}},
+	}
+	message := (&descriptorpb.FileDescriptorProto{}).ProtoReflect().Descriptor()
+	t.Run("with descriptor", func(t *testing.T) {
+		parsed, err := parseQuery(query, message, false)
+		assert.NoError(t, err)
+		got, err := json.Marshal(parsed)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"second","dependency":["a.proto"],"options":{"javaPackage":"com.example","go_package":"{\"not\":\"decoded\"}"},"unknown":["x","y"]}`, string(got))
+	})
+	t.Run("without descriptor", func(t *testing.T) {
+		parsed, err := parseQuery(query, nil, false)
+		assert.NoError(t, err)
+		got, err := json.Marshal(parsed)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":["first","second"],"dependency":"a.proto","options":{"javaPackage":"com.example","go_package":"{\"not\":\"decoded\"}"},"unknown":["x","y"]}`, string(got))
+	})
+	t.Run("JSON params", func(t *testing.T) {
+		parsed, err := parseQuery(query, message, true)
+		assert.NoError(t, err)
+		got, err := json.Marshal(parsed)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"second","dependency":["a.proto"],"options":{"javaPackage":"com.example","go_package":{"not":"decoded"}},"unknown":["x","y"]}`, string(got))
+	})
+}
+
+func TestParseQuery_Coercion(t *testing.T) {
+	// FieldDescriptorProto covers ints, enums and nested messages, Timestamp and Duration cover the well-known types
+	field := (&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Descriptor()
+	tests := []struct {
+		name    string
+		message protoreflect.MessageDescriptor
+		query   map[string]*httpapi.MultiVal
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "scalars and enums",
+			message: field,
+			query: map[string]*httpapi.MultiVal{
+				"number":         {Values: []string{"5"}},
+				"label":          {Values: []string{"LABEL_REPEATED"}},
+				"type":           {Values: []string{"9"}},
+				"options.packed": {Values: []string{"true"}},
+				"options.lazy":   {Values: []string{"false"}},
+				"options.uninterpretedOption.positiveIntValue": {Values: []string{"1"}},
+			},
+			want: `{"number":5,"label":"LABEL_REPEATED","type":9,"options":{"packed":true,"lazy":false,"uninterpretedOption":{"positiveIntValue":"1"}}}`,
+		},
+		{
+			name:    "bad int",
+			message: field,
+			query:   map[string]*httpapi.MultiVal{"number": {Values: []string{"five"}}},
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: invalid value "five" for field number: expected a 32-bit integer`,
+		},
+		{
+			name:    "bad nested bool",
+			message: field,
+			query:   map[string]*httpapi.MultiVal{"options.packed": {Values: []string{"maybe"}}},
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: invalid value "maybe" for field options.packed: expected a bool`,
+		},
+		{
+			name:    "bad enum",
+			message: field,
+			query:   map[string]*httpapi.MultiVal{"label": {Values: []string{"LABEL_SOMETIMES"}}},
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: invalid value "LABEL_SOMETIMES" for field label: expected a value of google.protobuf.FieldDescriptorProto.Label`,
+		},
+		{
+			name:    "message",
+			message: field,
+			query:   map[string]*httpapi.MultiVal{"options": {Values: []string{"x"}}},
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: invalid value "x" for field options: google.protobuf.FieldOptions messages cannot be set from a string, set their fields instead`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseQuery(tt.query, tt.message, false)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			got, err := json.Marshal(parsed)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestCoerceValue_WellKnownTypes(t *testing.T) {
+	tests := []struct {
+		message protoreflect.MessageDescriptor
+		value   string
+		want    interface{}
+		wantErr bool
+	}{
+		{message: (&timestamppb.Timestamp{}).ProtoReflect().Descriptor(), value: "2020-01-02T03:04:05Z", want: "2020-01-02T03:04:05Z"},
+		{message: (&timestamppb.Timestamp{}).ProtoReflect().Descriptor(), value: "yesterday", wantErr: true},
+		{message: (&durationpb.Duration{}).ProtoReflect().Descriptor(), value: "1.5s", want: "1.5s"},
+		{message: (&durationpb.Duration{}).ProtoReflect().Descriptor(), value: "90m", wantErr: true},
+		{message: (&wrapperspb.Int32Value{}).ProtoReflect().Descriptor(), value: "3", want: int64(3)},
+		{message: (&wrapperspb.BoolValue{}).ProtoReflect().Descriptor(), value: "yes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.message.FullName())+" "+tt.value, func(t *testing.T) {
+			got, err := coerceWellKnown(tt.message, tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
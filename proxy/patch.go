@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+	// updateMaskField is the request field which receives the FieldMask computed from a PATCH body, if the request message has one
+	updateMaskField = "update_mask"
+)
+
+// preparePatch converts RFC 7396 merge patch and RFC 6902 JSON patch bodies into a plain JSON body, along with the proto field paths they update relative to message.
+// Other bodies are returned unchanged with no paths
+func preparePatch(req *httpapi.Request, bodyJSON []byte, message protoreflect.MessageDescriptor) (body []byte, paths []string, isPatch bool, err error) {
+	if req.GetMethod() != httpapi.Method_PATCH || len(bodyJSON) == 0 {
+		return bodyJSON, nil, false, nil
+	}
+	contentType := ""
+	if values := req.GetHeaders()["Content-Type"].GetValues(); len(values) > 0 {
+		contentType, _, _ = mime.ParseMediaType(values[0])
+	}
+	switch contentType {
+	case mergePatchContentType:
+		var patch map[string]interface{}
+		if json.Unmarshal(bodyJSON, &patch) != nil || patch == nil {
+			return nil, nil, true, status.Error(codes.InvalidArgument, "mercury: merge patch body must be a JSON object")
+		}
+		paths = []string{}
+		mergePatchPaths(patch, message, "", &paths)
+		return bodyJSON, paths, true, nil
+	case jsonPatchContentType:
+		body, paths, err = applyJSONPatch(bodyJSON, message)
+		return body, paths, true, err
+	}
+	return bodyJSON, nil, false, nil
+}
+
+// mergePatchPaths appends the path of every leaf field set or cleared by a merge patch, and of every empty object, descending into nested messages
+func mergePatchPaths(patch map[string]interface{}, message protoreflect.MessageDescriptor, prefix string, paths *[]string) {
+	for key, value := range patch {
+		name := key
+		var field protoreflect.FieldDescriptor
+		if message != nil {
+			field = resolveField(message, []string{key})
+			if field == nil {
+				// Unknown fields are discarded when unmarshalling, so they can't be updated either
+				continue
+			}
+			name = string(field.Name())
+		}
+		child, isObject := value.(map[string]interface{})
+		switch {
+		case isObject && len(child) == 0:
+			// An empty object has no leaves of its own, but still sets the message it names
+			*paths = append(*paths, prefix+name)
+		case isObject && field != nil && isPatchableMessage(field):
+			mergePatchPaths(child, field.Message(), prefix+name+".", paths)
+		case isObject && message == nil:
+			mergePatchPaths(child, nil, prefix+name+".", paths)
+		default:
+			*paths = append(*paths, prefix+name)
+		}
+	}
+}
+
+// isPatchableMessage is true for singular message fields whose own fields may be patched individually, rather than replaced as a whole
+func isPatchableMessage(field protoreflect.FieldDescriptor) bool {
+	return field.Kind() == protoreflect.MessageKind && !field.IsList() && !field.IsMap() &&
+		!strings.HasPrefix(string(field.Message().FullName()), "google.protobuf.")
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the add, replace and remove operations of a JSON patch to an empty request. Operations on list elements, and the test, move and copy operations, need the existing resource so they aren't supported
+func applyJSONPatch(bodyJSON []byte, message protoreflect.MessageDescriptor) (body []byte, paths []string, err error) {
+	var operations []jsonPatchOperation
+	if json.Unmarshal(bodyJSON, &operations) != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, "mercury: JSON patch body must be an array of operations")
+	}
+	request := map[string]interface{}{}
+	paths = []string{}
+	for i, operation := range operations {
+		segments, err := jsonPointerFieldPath(operation.Path, message)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "mercury: JSON patch operation %d: %v", i, err)
+		}
+		switch operation.Op {
+		case "add", "replace":
+			var value interface{}
+			if len(operation.Value) == 0 || json.Unmarshal(operation.Value, &value) != nil {
+				return nil, nil, status.Errorf(codes.InvalidArgument, "mercury: JSON patch operation %d: %s requires a value", i, operation.Op)
+			}
+			setField(request, segments, value)
+		case "remove":
+			setField(request, segments, nil)
+		default:
+			return nil, nil, status.Errorf(codes.InvalidArgument, "mercury: JSON patch operation %d: unsupported operation %q", i, operation.Op)
+		}
+		paths = append(paths, strings.Join(segments, "."))
+	}
+	body, err = json.Marshal(request)
+	return body, paths, err
+}
+
+// jsonPointerFieldPath converts an RFC 6901 JSON pointer to proto field names, rejecting pointers into lists and maps
+func jsonPointerFieldPath(pointer string, message protoreflect.MessageDescriptor) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") || pointer == "/" {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	segments := strings.Split(pointer[1:], "/")
+	for i, segment := range segments {
+		segment = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+		if segment == "-" {
+			return nil, fmt.Errorf("path %q refers to a list element", pointer)
+		}
+		if _, err := strconv.Atoi(segment); err == nil && message == nil {
+			return nil, fmt.Errorf("path %q refers to a list element", pointer)
+		}
+		segments[i] = segment
+		if message == nil {
+			continue
+		}
+		field := resolveField(message, []string{segment})
+		if field == nil {
+			return nil, fmt.Errorf("path %q refers to an unknown field", pointer)
+		}
+		segments[i] = string(field.Name())
+		message = nil
+		if i < len(segments)-1 {
+			if !isPatchableMessage(field) {
+				return nil, fmt.Errorf("path %q refers to an element of %s, which can only be replaced as a whole", pointer, field.Name())
+			}
+			message = field.Message()
+		}
+	}
+	return segments, nil
+}
+
+// setUpdateMask sets the update_mask field of the request to paths, unless the message has no such FieldMask field or the client already set it
+func setUpdateMask(requestJSON []byte, paths []string, message protoreflect.MessageDescriptor) ([]byte, error) {
+	field := resolveField(message, []string{updateMaskField})
+	if field == nil || field.Kind() != protoreflect.MessageKind || field.Message().FullName() != "google.protobuf.FieldMask" {
+		return requestJSON, nil
+	}
+	requestMap := map[string]interface{}{}
+	if len(requestJSON) > 0 {
+		err := json.Unmarshal(requestJSON, &requestMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshall request JSON: %v", err)
+		}
+	}
+	if _, found := requestMap[updateMaskField]; found {
+		return requestJSON, nil
+	}
+	if _, found := requestMap[field.JSONName()]; found {
+		return requestJSON, nil
+	}
+	// FieldMask's JSON form is a comma separated list of lowerCamelCase paths
+	sort.Strings(paths)
+	jsonPaths := make([]string, 0, len(paths))
+	for i, path := range paths {
+		if i > 0 && path == paths[i-1] {
+			continue
+		}
+		segments := strings.Split(path, ".")
+		for j, segment := range segments {
+			segments[j] = jsonCamelCase(segment)
+		}
+		jsonPaths = append(jsonPaths, strings.Join(segments, "."))
+	}
+	requestMap[updateMaskField] = strings.Join(jsonPaths, ",")
+	return json.Marshal(requestMap)
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// newUpdateRequestDescriptor builds the descriptor for
+//
+//	message Photo { string title = 1; Location location = 2; repeated string tags = 3; }
+//	message Location { string city = 1; string country_code = 2; }
+//	message UpdatePhotoRequest { Photo photo = 1; google.protobuf.FieldMask update_mask = 2; }
+func newUpdateRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Label: label.Enum(), Type: kind.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	str, msg := descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("photos_patch.proto"),
+		Package:    proto.String("photos"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/field_mask.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Photo"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("title", 1, optional, str, ""),
+				field("location", 2, optional, msg, ".photos.Location"),
+				field("tags", 3, repeated, str, ""),
+			}},
+			{Name: proto.String("Location"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("city", 1, optional, str, ""),
+				field("country_code", 2, optional, str, ""),
+			}},
+			{Name: proto.String("UpdatePhotoRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("photo", 1, optional, msg, ".photos.Photo"),
+				field("update_mask", 2, optional, msg, ".google.protobuf.FieldMask"),
+			}},
+		},
+	}, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	return file.Messages().ByName("UpdatePhotoRequest")
+}
+
+func TestParseRequest_Patch(t *testing.T) {
+	message := newUpdateRequestDescriptor(t)
+	template, err := httprule.Parse("/v1/photos/{photo.title}")
+	assert.NoError(t, err)
+	photoBinding := []httprule.Binding{{Method: "PATCH", Template: template, Body: "photo"}}
+	newRequest := func(contentType, payload string) *httpapi.Request {
+		return &httpapi.Request{
+			Method: httpapi.Method_PATCH,
+			Headers: map[string]*httpapi.MultiVal{
+				"Content-Type":     {Values: []string{contentType}},
+				convert.PathHeader: {Values: []string{"/v1/photos/abc"}},
+			},
+			Payload: []byte(payload),
+		}
+	}
+	tests := []struct {
+		name     string
+		req      *httpapi.Request
+		bindings []httprule.Binding
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "merge patch",
+			req:  newRequest("application/merge-patch+json; charset=utf-8", `{"photo":{"location":{"countryCode":"NZ","city":null},"tags":["a"]}}`),
+			want: `{"photo":{"location":{"countryCode":"NZ","city":null},"tags":["a"]},"update_mask":"photo.location.city,photo.location.countryCode,photo.tags"}`,
+		},
+		{
+			name: "merge patch with an empty object",
+			req:  newRequest("application/merge-patch+json", `{"photo":{"location":{},"title":"x"}}`),
+			want: `{"photo":{"location":{},"title":"x"},"update_mask":"photo.location,photo.title"}`,
+		},
+		{
+			name:     "merge patch relative to body field",
+			req:      newRequest("application/merge-patch+json", `{"location":{"city":"Wellington"},"unknown":1}`),
+			bindings: photoBinding,
+			want:     `{"photo":{"location":{"city":"Wellington"},"unknown":1,"title":"abc"},"update_mask":"location.city"}`,
+		},
+		{
+			name: "client mask wins",
+			req:  newRequest("application/merge-patch+json", `{"photo":{"title":"x"},"updateMask":"photo"}`),
+			want: `{"photo":{"title":"x"},"updateMask":"photo"}`,
+		},
+		{
+			name: "plain JSON has no mask",
+			req:  newRequest("application/json", `{"photo":{"title":"x"}}`),
+			want: `{"photo":{"title":"x"}}`,
+		},
+		{
+			name: "JSON patch",
+			req:  newRequest("application/json-patch+json", `[{"op":"replace","path":"/photo/location","value":{"city":"Auckland"}},{"op":"remove","path":"/photo/title"}]`),
+			want: `{"photo":{"location":{"city":"Auckland"},"title":null},"update_mask":"photo.location,photo.title"}`,
+		},
+		{
+			name:    "JSON patch into a list",
+			req:     newRequest("application/json-patch+json", `[{"op":"add","path":"/photo/tags/-","value":"a"}]`),
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: JSON patch operation 0: path "/photo/tags/-" refers to an element of tags, which can only be replaced as a whole`,
+		},
+		{
+			name:    "JSON patch test",
+			req:     newRequest("application/json-patch+json", `[{"op":"test","path":"/photo/title","value":"a"}]`),
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: JSON patch operation 0: unsupported operation "test"`,
+		},
+		{
+			name:    "merge patch not an object",
+			req:     newRequest("application/merge-patch+json", `[]`),
+			wantErr: `rpc error: code = InvalidArgument desc = mercury: merge patch body must be a JSON object`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRequest(tt.req, tt.bindings, message, false)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
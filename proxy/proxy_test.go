@@ -83,7 +83,7 @@ func TestServer_Proxy(t *testing.T) {
 				},
 				innerServer: &httpapi.UnimplementedExposedServiceServer{},
 			},
-			ctx: new(mockContext),
+			ctx: newMockContext(),
 			req: &httpapi.Request{
 				Method:    httpapi.Method_POST,
 				Procedure: "Proxy",
@@ -103,7 +103,7 @@ func TestServer_Proxy(t *testing.T) {
 				},
 				innerServer: &exampleService{},
 			},
-			ctx: new(mockContext),
+			ctx: newMockContext(),
 			req: &httpapi.Request{
 				Method:    httpapi.Method_POST,
 				Procedure: "Example",
@@ -120,7 +120,7 @@ func TestServer_Proxy(t *testing.T) {
 		{
 			name:        "blank request",
 			s:           &Server{},
-			ctx:         new(mockContext),
+			ctx:         newMockContext(),
 			req:         &httpapi.Request{},
 			want:        &httpapi.Response{},
 			expectedErr: fmt.Sprintf("%v", status.Error(codes.Unimplemented, "mercury: unknown HTTP method")),
@@ -128,7 +128,7 @@ func TestServer_Proxy(t *testing.T) {
 		{
 			name: "unregistered method",
 			s:    &Server{},
-			ctx:  new(mockContext),
+			ctx:  newMockContext(),
 			req: &httpapi.Request{
 				Method: httpapi.Method_POST,
 			},
@@ -142,7 +142,7 @@ func TestServer_Proxy(t *testing.T) {
 					"POST": {},
 				},
 			},
-			ctx: new(mockContext),
+			ctx: newMockContext(),
 			req: &httpapi.Request{
 				Method:    httpapi.Method_POST,
 				Procedure: "DoThing",
@@ -160,7 +160,7 @@ func TestServer_Proxy(t *testing.T) {
 		// 		},
 		// 		innerServer: &thingA{},
 		// 	},
-		// 	ctx: new(mockContext),
+		// 	ctx: newMockContext(),
 		// 	req: &httpapi.Request{
 		// 		Method:    httpapi.Method_POST,
 		// 		Procedure: "DoThing",
@@ -189,6 +189,15 @@ type mockContext struct {
 	mock.Mock
 }
 
+// newMockContext creates a mockContext which is never cancelled and holds no values
+func newMockContext() *mockContext {
+	ctx := new(mockContext)
+	ctx.On("Done").Return(nil)
+	ctx.On("Err").Return(nil)
+	ctx.On("Value", mock.Anything).Return(nil)
+	return ctx
+}
+
 // Deadline provides a mock function with given fields:
 func (_m *mockContext) Deadline() (time.Time, bool) {
 	ret := _m.Called()
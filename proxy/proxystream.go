@@ -25,7 +25,12 @@ func (s *Server) ProxyStream(srv httpapi.ExposedService_ProxyStreamServer) (err
 			fmt.Printf("%s\n", debug.Stack())
 		}
 	}()
-	ctx := srv.Context()
+	ctx, active, end, err := s.beginCall(srv.Context())
+	if err != nil {
+		return err
+	}
+	defer end()
+	srv = newDrainingStream(ctx, srv, active)
 	initMsg, err := srv.Recv()
 	if err != nil {
 		return wrapErr(codes.InvalidArgument, fmt.Errorf("could not receive initial routing message in ProxyClientStream: %v", err))
@@ -41,13 +46,35 @@ func (s *Server) ProxyStream(srv httpapi.ExposedService_ProxyStreamServer) (err
 	if err != nil {
 		return wrapErr(codes.Unimplemented, err)
 	}
+	s.announceDeprecation(ctx, msg.GetMethod(), msg.GetProcedure(), msg.GetHeaders(), srv.SetHeader)
+	release, err := s.acquireSlots(ctx, msg.GetProcedure())
+	if err != nil {
+		return err
+	}
+	defer release()
+	codec, err := s.codecFor(msg.GetProcedure(), msg.GetHeaders()).withFields(streamFields(msg), responseDescriptor(procType))
+	if err != nil {
+		return err
+	}
+	if !isUpload(msg) && !isDownload(msg) {
+		// convert answers the websocket handshake with these headers, so they can't wait for the first response
+		srv.SendHeader(nil)
+	}
 	switch pattern {
 	case apiMethodPatternStreamStream:
-		err = s.handleDualStream(ctx, procType, caller, srv)
+		err = s.handleDualStream(ctx, msg.GetProcedure(), procType, caller, srv, codec)
 	case apiMethodPatternStreamStruct:
-		err = s.handleClientStream(ctx, procType, caller, srv)
+		if isUpload(msg) {
+			err = s.handleUpload(ctx, msg, procType, caller, srv, codec)
+			break
+		}
+		err = s.handleClientStream(ctx, msg.GetProcedure(), procType, caller, srv, codec)
 	case apiMethodPatternStructStream:
-		err = s.handleServerStream(ctx, procType, caller, srv)
+		if isDownload(msg) {
+			err = s.handleDownload(ctx, msg, procType, caller, srv, codec)
+			break
+		}
+		err = s.handleServerStream(ctx, msg.GetProcedure(), procType, caller, srv, codec)
 	case apiMethodPatternStructStruct:
 		err = wrapErr(codes.Unimplemented, fmt.Errorf("ProxyStream called for non-stream RPC"))
 	case apiMethodPatternUnknown:
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"github.com/LLKennedy/mercury/convert"
 	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // ProxyUnary proxies connections through the server
@@ -27,12 +31,21 @@ func (s *Server) ProxyUnary(ctx context.Context, req *httpapi.Request) (res *htt
 			err = wrapErr(codes.Internal, fmt.Errorf("caught panic %v", r))
 		}
 	}()
+	ctx, _, end, err := s.beginCall(ctx)
+	if err != nil {
+		return &httpapi.Response{}, err
+	}
+	defer end()
 	var handled bool
 	handled, res, err = s.handleExceptions(ctx, req)
 	if handled {
 		// The user-defined exception handler already processes this request, we don't have to deal with it
 		return
 	}
+	req, automatic, head := s.automaticMethod(req)
+	if automatic != nil {
+		return automatic, nil
+	}
 	procType, caller, pattern, err := s.findProc(req.GetMethod(), req.GetProcedure())
 	if err != nil {
 		return &httpapi.Response{}, wrapErr(codes.Unimplemented, err)
@@ -43,12 +56,32 @@ func (s *Server) ProxyUnary(ctx context.Context, req *httpapi.Request) (res *htt
 	if pattern != apiMethodPatternStructStruct {
 		return &httpapi.Response{}, wrapErr(codes.InvalidArgument, fmt.Errorf("ProxyUnary called for non-unary RPC"))
 	}
-	var inputJSON []byte
-	inputJSON, err = parseRequest(req)
+	s.announceDeprecation(ctx, req.GetMethod(), req.GetProcedure(), req.GetHeaders(), func(md metadata.MD) error {
+		return grpc.SetHeader(ctx, md)
+	})
+	release, err := s.acquireSlots(ctx, req.GetProcedure())
 	if err != nil {
+		return &httpapi.Response{}, err
+	}
+	defer release()
+	parsed, selector := takeFields(req)
+	codec, err := s.codecFor(req.GetProcedure(), req.GetHeaders()).withFields(selector, responseDescriptor(procType))
+	if err != nil {
+		return &httpapi.Response{}, err
+	}
+	var inputJSON []byte
+	inputJSON, err = parseRequest(parsed, s.findBindings(req.GetMethod(), req.GetProcedure()), requestDescriptor(procType), s.getJSONQueryParams())
+	if _, isStatus := status.FromError(err); err != nil && isStatus {
+		// Invalid params are already described by a status error
+		return &httpapi.Response{}, err
+	} else if err != nil {
 		return &httpapi.Response{}, wrapErr(codes.Internal, err)
 	}
-	res, err = s.callStructStruct(ctx, inputJSON, procType, caller)
+	res, err = s.callStructStruct(ctx, req, inputJSON, procType, caller, codec)
+	if head && res != nil {
+		// HEAD is served by the GET procedure, but only the status and headers are wanted
+		res.Payload = nil
+	}
 	return res, err
 }
 
@@ -75,8 +108,29 @@ func (s *Server) findProc(httpMethod httpapi.Method, procName string) (procType
 	return
 }
 
+// findBindings returns the google.api.http bindings of a procedure, if it has any
+func (s *Server) findBindings(httpMethod httpapi.Method, procName string) []httprule.Binding {
+	methodString, err := methodToString(httpMethod)
+	if err != nil {
+		return nil
+	}
+	return s.getAPI()[methodString][procName].bindings
+}
+
+// requestDescriptor returns the message descriptor for the request argument of a unary procedure, or nil if it isn't a proto message
+func requestDescriptor(procType reflect.Type) protoreflect.MessageDescriptor {
+	if procType.NumIn() < 3 || procType.In(2).Kind() != reflect.Ptr {
+		return nil
+	}
+	message, ok := reflect.New(procType.In(2).Elem()).Interface().(proto.Message)
+	if !ok {
+		return nil
+	}
+	return message.ProtoReflect().Descriptor()
+}
+
 // One struct in, one struct out
-func (s *Server) callStructStruct(ctx context.Context, inputJSON []byte, procType reflect.Type, caller reflect.Value) (res *httpapi.Response, err error) {
+func (s *Server) callStructStruct(ctx context.Context, req *httpapi.Request, inputJSON []byte, procType reflect.Type, caller reflect.Value, codec codec) (res *httpapi.Response, err error) {
 	// Create new instance of struct argument to pass into real implementation
 	builtRequest := reflect.New(procType.In(2).Elem())
 	builtRequestPtr := builtRequest.Interface()
@@ -87,23 +141,40 @@ func (s *Server) callStructStruct(ctx context.Context, inputJSON []byte, procTyp
 	if inputJSON == nil {
 		inputJSON = []byte("{}")
 	}
-	err = unmarshaller.Unmarshal(inputJSON, builtRequestMessage)
+	err = codec.unmarshaller.Unmarshal(inputJSON, builtRequestMessage)
 	if err != nil {
 		return &httpapi.Response{}, status.Error(codes.InvalidArgument, fmt.Sprintf("mercury: %v", err))
 	}
+	err = s.validate(ctx, req.GetProcedure(), builtRequestMessage)
+	if err != nil {
+		return &httpapi.Response{}, err
+	}
 	if !s.getSkipForwardingMetadata() {
 		incoming, ok := metadata.FromIncomingContext(ctx)
 		if ok {
 			ctx = metadata.NewOutgoingContext(ctx, incoming)
 		}
 	}
+	var outMessage proto.Message
 	var outJSON []byte
 	var jsonErr error
-	returnValues := caller.Call([]reflect.Value{reflect.ValueOf(ctx), builtRequest})
+	var rawContentType string
+	isRaw := false
+	args := []reflect.Value{reflect.ValueOf(ctx), builtRequest}
+	var header metadata.MD
+	if caller.Type().IsVariadic() {
+		// The caller is a gRPC client, capture its response metadata so we can pass it back through to the HTTP response
+		args = append(args, reflect.ValueOf(grpc.Header(&header)))
+	}
+	returnValues := caller.Call(args)
+	forwardHeader(ctx, header)
 	if returnValues[0].CanInterface() {
-		outMessage, ok := (returnValues[0].Interface()).(proto.Message)
+		outMessage, ok = (returnValues[0].Interface()).(proto.Message)
 		if ok {
-			outJSON, jsonErr = marshaller.Marshal(outMessage)
+			outJSON, rawContentType, isRaw = rawResponse(outMessage)
+			if !isRaw {
+				outJSON, jsonErr = codec.marshal(outMessage)
+			}
 		} else {
 			jsonErr = status.Errorf(codes.Internal, "response message could not be converted to protMessage interface")
 		}
@@ -117,7 +188,7 @@ func (s *Server) callStructStruct(ctx context.Context, inputJSON []byte, procTyp
 	if jsonErr != nil && err == nil {
 		outJSON = nil
 		err = status.Errorf(codes.Internal, "could not marshal response message to JSON: %v", jsonErr)
-	} else if jsonErr != nil || outJSON != nil && (len(outJSON) == 0 || string(outJSON) == "null" || string(outJSON) == "{}") {
+	} else if jsonErr != nil || !isRaw && outJSON != nil && (len(outJSON) == 0 || string(outJSON) == "null" || string(outJSON) == "{}") {
 		outJSON = nil
 	}
 	res = &httpapi.Response{
@@ -125,6 +196,15 @@ func (s *Server) callStructStruct(ctx context.Context, inputJSON []byte, procTyp
 	}
 	if err == nil {
 		res.StatusCode = http.StatusOK
+		if isRaw && rawContentType != "" {
+			res.WriteHeaders = map[string]*httpapi.MultiVal{"Content-Type": {Values: []string{rawContentType}}}
+		}
+		if link := s.nextPageLink(req, builtRequestMessage, outMessage); link != "" {
+			if res.WriteHeaders == nil {
+				res.WriteHeaders = map[string]*httpapi.MultiVal{}
+			}
+			res.WriteHeaders["Link"] = &httpapi.MultiVal{Values: []string{link}}
+		}
 	} else {
 		sErr, ok := status.FromError(err)
 		if !ok {
@@ -137,3 +217,18 @@ func (s *Server) callStructStruct(ctx context.Context, inputJSON []byte, procTyp
 	}
 	return
 }
+
+// forwardHeader sends response metadata from the inner call back to the mercury client, skipping metadata used by gRPC itself
+func forwardHeader(ctx context.Context, header metadata.MD) {
+	forwarded := metadata.MD{}
+	for key, values := range header {
+		if key == "content-type" || strings.HasPrefix(key, "grpc-") || strings.HasPrefix(key, ":") {
+			continue
+		}
+		forwarded[key] = values
+	}
+	if len(forwarded) > 0 {
+		// This can only fail if ctx doesn't come from a gRPC server, in which case there's nobody to send headers to anyway
+		grpc.SetHeader(ctx, forwarded)
+	}
+}
@@ -3,9 +3,18 @@ package proxy
 import (
 	"context"
 	"reflect"
+	"sync"
+	"sync/atomic"
 
 	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/drain"
+	"github.com/LLKennedy/mercury/internal/httprule"
+	"github.com/LLKennedy/mercury/logs"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type apiMethodPattern int
@@ -24,20 +33,36 @@ var defaultServer = &Server{}
 // ExceptionHandler is an exception handler function
 type ExceptionHandler func(ctx context.Context, req *httpapi.Request) (handled bool, res *httpapi.Response, err error)
 
+// Validator checks a decoded request message before the procedure is called, a non-nil error is returned to the client instead of calling the procedure
+type Validator func(ctx context.Context, procedure string, req proto.Message) error
+
 // Server is an HTTP to GRPC proxy server
 type Server struct {
 	grpcServer       *grpc.Server
 	api              map[string]map[string]apiMethod // the api of innerServer
 	innerServer      interface{}                     // the actual protobuf endpoints we want to use
 	exceptionHandler ExceptionHandler
+	validator        Validator
 	httpapi.UnimplementedExposedServiceServer
 	skipForwardingMetadata bool
+	jsonQueryParams        bool
+	paginationLinks        bool
+	loggers                []logs.Writer
+	limits                 atomic.Value // *serverLimits
+	limitsOnce             sync.Once
+	marshalling            atomic.Value // *serverMarshalling
+	marshallingOnce        sync.Once
+	downloads              map[string]Download
+	uploads                map[string]Upload
+	drain                  drain.Drainer
 }
 
 type apiMethod struct {
-	pattern    apiMethodPattern
-	reflection reflect.Method
-	value      reflect.Value
+	pattern     apiMethodPattern
+	reflection  reflect.Method
+	value       reflect.Value
+	bindings    []httprule.Binding // from the method's google.api.http option, if it has one
+	deprecation metadata.MD        // headers announcing the method's deprecation, if it is deprecated
 }
 
 func (s *Server) getGrpcServer() *grpc.Server {
@@ -98,6 +123,38 @@ func (s *Server) setSkipForwardingMetadata(in bool) {
 	s.skipForwardingMetadata = in
 }
 
+// SetJSONQueryParams sets whether query param values which are JSON objects are decoded into nested messages, as they were before dotted keys like filter.owner.id were supported
+func (s *Server) SetJSONQueryParams(enabled bool) {
+	if s == nil {
+		defaultServer.jsonQueryParams = enabled
+		return
+	}
+	s.jsonQueryParams = enabled
+}
+
+func (s *Server) getJSONQueryParams() bool {
+	if s == nil {
+		return defaultServer.jsonQueryParams
+	}
+	return s.jsonQueryParams
+}
+
+// SetPaginationLinks sets whether GET responses of List procedures following AIP-158, with page_size and page_token request fields and a next_page_token response field, get a Link header to their next page
+func (s *Server) SetPaginationLinks(enabled bool) {
+	if s == nil {
+		defaultServer.paginationLinks = enabled
+		return
+	}
+	s.paginationLinks = enabled
+}
+
+func (s *Server) getPaginationLinks() bool {
+	if s == nil {
+		return defaultServer.paginationLinks
+	}
+	return s.paginationLinks
+}
+
 func (s *Server) handleExceptions(ctx context.Context, req *httpapi.Request) (handled bool, res *httpapi.Response, err error) {
 	if s == nil || s.exceptionHandler == nil {
 		handled = false
@@ -105,3 +162,18 @@ func (s *Server) handleExceptions(ctx context.Context, req *httpapi.Request) (ha
 	}
 	return s.exceptionHandler(ctx, req)
 }
+
+// validate runs the validator on a request message, errors which aren't already status errors are returned as InvalidArgument
+func (s *Server) validate(ctx context.Context, procedure string, req proto.Message) error {
+	if s == nil || s.validator == nil {
+		return nil
+	}
+	err := s.validator(ctx, procedure, req)
+	if err == nil {
+		return nil
+	}
+	if _, isStatus := status.FromError(err); isStatus {
+		return err
+	}
+	return status.Errorf(codes.InvalidArgument, "mercury: %v", err)
+}
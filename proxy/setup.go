@@ -5,6 +5,7 @@ import (
 	"net"
 	"reflect"
 
+	"github.com/LLKennedy/mercury/logs"
 	"google.golang.org/grpc"
 )
 
@@ -34,6 +35,17 @@ func (s *Server) SetExceptionHandler(handler ExceptionHandler) {
 	s.exceptionHandler = handler
 }
 
+// SetValidator sets a function which checks every request message after it is decoded and before the procedure is called, including each message of a stream.
+// The validate package provides one driven by constraint options on the request's fields
+func (s *Server) SetValidator(validator Validator) {
+	s.validator = validator
+}
+
+// SetLoggers sets where the server logs calls which need attention, such as calls to deprecated procedures
+func (s *Server) SetLoggers(loggers ...logs.Writer) {
+	s.loggers = loggers
+}
+
 // register registers the server
 func (s *Server) register(listener *grpc.Server) {
 	s.setGrpcServer(listener)
@@ -59,13 +71,24 @@ func (s *Server) setAPIConfig(api, server interface{}) (err error) {
 			return err
 		}
 		value := reflect.ValueOf(server).MethodByName(procedureName)
+		method := findMethod(apiType, apiMethodReflection, pattern)
+		bindings, err := findBindings(apiMethodReflection, method, methodString)
+		if err != nil {
+			return err
+		}
+		deprecation, err := deprecationHeaders(method)
+		if err != nil {
+			return err
+		}
 		if _, exists := apiMethods[methodString]; !exists {
 			apiMethods[methodString] = map[string]apiMethod{}
 		}
 		apiMethods[methodString][procedureName] = apiMethod{
-			pattern:    pattern,
-			reflection: apiMethodReflection,
-			value:      value,
+			pattern:     pattern,
+			reflection:  apiMethodReflection,
+			value:       value,
+			bindings:    bindings,
+			deprecation: deprecation,
 		}
 	}
 	// We know all api functions map to server functions, now hold onto the method list and server pointer for later
@@ -10,6 +10,9 @@ import (
 	"github.com/LLKennedy/mercury/httpapi"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type emptyThing struct{}
@@ -111,6 +114,29 @@ func TestSetExceptionHandler(t *testing.T) {
 	})
 }
 
+func TestSetValidator(t *testing.T) {
+	t.Run("no validator", func(t *testing.T) {
+		s := &Server{}
+		assert.NoError(t, s.validate(context.Background(), "Photo", &httpapi.Request{}))
+	})
+	t.Run("plain errors are invalid arguments", func(t *testing.T) {
+		s := &Server{}
+		s.SetValidator(func(ctx context.Context, procedure string, req proto.Message) error {
+			return fmt.Errorf("%s is invalid", procedure)
+		})
+		err := s.validate(context.Background(), "Photo", &httpapi.Request{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.EqualError(t, err, "rpc error: code = InvalidArgument desc = mercury: Photo is invalid")
+	})
+	t.Run("status errors are unchanged", func(t *testing.T) {
+		s := &Server{}
+		s.SetValidator(func(ctx context.Context, procedure string, req proto.Message) error {
+			return status.Error(codes.FailedPrecondition, "not yet")
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(s.validate(context.Background(), "Photo", &httpapi.Request{})))
+	})
+}
+
 func TestNewServer(t *testing.T) {
 	gS := grpc.NewServer()
 	type args struct {
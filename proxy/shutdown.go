@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/LLKennedy/mercury/internal/drain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Shutdown stops the Server accepting new ProxyUnary and ProxyStream calls, rejecting them with Unavailable, and tells every open stream to go away, which convert passes on to websocket clients as convert.GoingAwayMessage.
+// In-flight calls are given until ctx expires to finish, after which they are cancelled and ctx.Err() is returned.
+// The gRPC server passed to NewServer is then stopped gracefully, or immediately if ctx has already expired.
+func (s *Server) Shutdown(ctx context.Context) (err error) {
+	d := s.getDrainer()
+	select {
+	case <-d.Close():
+	case <-ctx.Done():
+		d.CancelAll()
+		err = ctx.Err()
+	}
+	grpcServer := s.getGrpcServer()
+	if grpcServer == nil {
+		return
+	}
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+		err = ctx.Err()
+	}
+	return
+}
+
+func (s *Server) getDrainer() *drain.Drainer {
+	if s == nil {
+		return &defaultServer.drain
+	}
+	return &s.drain
+}
+
+// beginCall returns an Unavailable error if the Server is shutting down, otherwise it returns the context to use for the call and a function to call when it has finished
+func (s *Server) beginCall(ctx context.Context) (callCtx context.Context, active *drain.Request, end func(), err error) {
+	d := s.getDrainer()
+	callCtx, active, ok := d.Begin(ctx)
+	if !ok {
+		return nil, nil, nil, status.Error(codes.Unavailable, "mercury: server is shutting down")
+	}
+	return callCtx, active, func() { d.End(active) }, nil
+}
+
+// drainingStream serialises Send calls so a going-away message can be sent alongside the normal response pump, and replaces the stream's context with one cancelled on shutdown
+type drainingStream struct {
+	httpapi.ExposedService_ProxyStreamServer
+	ctx context.Context
+	mu  sync.Mutex
+}
+
+func newDrainingStream(ctx context.Context, srv httpapi.ExposedService_ProxyStreamServer, active *drain.Request) *drainingStream {
+	stream := &drainingStream{
+		ExposedService_ProxyStreamServer: srv,
+		ctx:                              ctx,
+	}
+	active.OnGoAway(func() {
+		stream.Send(&httpapi.StreamedResponse{
+			GoingAway: true,
+		})
+	})
+	return stream
+}
+
+func (d *drainingStream) Context() context.Context {
+	return d.ctx
+}
+
+func (d *drainingStream) Send(res *httpapi.StreamedResponse) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ExposedService_ProxyStreamServer.Send(res)
+}
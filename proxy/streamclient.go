@@ -15,7 +15,12 @@ import (
 )
 
 // Stream of structs in, one struct out
-func (s *Server) handleClientStream(ctx context.Context, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer) (err error) {
+func (s *Server) handleClientStream(ctx context.Context, procedure string, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec) (err error) {
+	return s.pumpClientStream(ctx, procedure, caller, srv, codec, nil)
+}
+
+// pumpClientStream sends each message from srv to the procedure, converting them with decode or unmarshalling them as JSON if decode is nil
+func (s *Server) pumpClientStream(ctx context.Context, procedure string, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec, decode func(data []byte) (proto.Message, error)) (err error) {
 	defer func() {
 		r := recover()
 		if r != nil {
@@ -55,11 +60,21 @@ func (s *Server) handleClientStream(ctx context.Context, procType reflect.Type,
 	recv := endpoint.MethodByName("CloseAndRecv")
 	sendT := send.Type()
 	reqT := sendT.In(0).Elem()
+	if decode == nil {
+		decode = func(data []byte) (proto.Message, error) {
+			msg := reflect.New(reqT).Interface().(proto.Message)
+			return msg, codec.unmarshaller.Unmarshal(data, msg)
+		}
+	}
 	var req *httpapi.StreamedRequest
 	req, err = srv.Recv()
 	for err == nil {
-		msg := reflect.New(reqT).Interface().(proto.Message)
-		err = unmarshaller.Unmarshal(req.GetRequest(), msg)
+		var msg proto.Message
+		msg, err = decode(req.GetRequest())
+		if err != nil {
+			break
+		}
+		err = s.validate(ctx, procedure, msg)
 		if err != nil {
 			break
 		}
@@ -80,7 +95,7 @@ func (s *Server) handleClientStream(ctx context.Context, procType reflect.Type,
 			return
 		}
 		var data []byte
-		data, err = marshaller.Marshal(res)
+		data, err = codec.marshal(res)
 		if err != nil {
 			return
 		}
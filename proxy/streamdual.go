@@ -15,7 +15,7 @@ import (
 )
 
 // Stram of structs in, stream of structs out
-func (s *Server) handleDualStream(ctx context.Context, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer) (err error) {
+func (s *Server) handleDualStream(ctx context.Context, procedure string, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec) (err error) {
 	defer func() {
 		r := recover()
 		if r != nil {
@@ -24,7 +24,7 @@ func (s *Server) handleDualStream(ctx context.Context, procType reflect.Type, ca
 		}
 	}()
 	// Client streaming always starts by passing the context and nothing else to receive a stream + error
-	returnValues := caller.Call([]reflect.Value{reflect.ValueOf(context.Background())})
+	returnValues := caller.Call([]reflect.Value{reflect.ValueOf(ctx)})
 	// Parse our return values
 	var clientErr error
 	var client grpc.ClientStream
@@ -57,8 +57,8 @@ func (s *Server) handleDualStream(ctx context.Context, procType reflect.Type, ca
 	reqT := sendT.In(0).Elem()
 	up := make(chan error, 1)
 	down := make(chan error, 1)
-	go s.up(client, reqT, srv, up)
-	go s.down(recv, srv, down)
+	go s.up(ctx, procedure, client, reqT, srv, codec, up)
+	go s.down(recv, srv, codec, down)
 	select {
 	case err = <-up:
 		if err != nil {
@@ -80,12 +80,16 @@ func (s *Server) handleDualStream(ctx context.Context, procType reflect.Type, ca
 	return
 }
 
-func (s *Server) up(client grpc.ClientStream, reqT reflect.Type, srv httpapi.ExposedService_ProxyStreamServer, done chan<- error) {
+func (s *Server) up(ctx context.Context, procedure string, client grpc.ClientStream, reqT reflect.Type, srv httpapi.ExposedService_ProxyStreamServer, codec codec, done chan<- error) {
 	defer close(done)
 	req, err := srv.Recv()
 	for err == nil {
 		msg := reflect.New(reqT).Interface().(proto.Message)
-		err = unmarshaller.Unmarshal(req.GetRequest(), msg)
+		err = codec.unmarshaller.Unmarshal(req.GetRequest(), msg)
+		if err != nil {
+			break
+		}
+		err = s.validate(ctx, procedure, msg)
 		if err != nil {
 			break
 		}
@@ -99,12 +103,12 @@ func (s *Server) up(client grpc.ClientStream, reqT reflect.Type, srv httpapi.Exp
 	done <- err
 }
 
-func (s *Server) down(recv reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, done chan<- error) {
+func (s *Server) down(recv reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec, done chan<- error) {
 	defer close(done)
 	res, err := wrapRecv(recv)
 	var data []byte
 	for err == nil {
-		data, err = marshaller.Marshal(res)
+		data, err = codec.marshal(res)
 		if err != nil {
 			break
 		}
@@ -15,7 +15,7 @@ import (
 )
 
 // One struct in, stream of structs out
-func (s *Server) handleServerStream(ctx context.Context, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer) (err error) {
+func (s *Server) handleServerStream(ctx context.Context, procedure string, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec) (err error) {
 	defer func() {
 		r := recover()
 		if r != nil {
@@ -30,10 +30,14 @@ func (s *Server) handleServerStream(ctx context.Context, procType reflect.Type,
 	}
 	onlyUpData := onlyUpMsg.GetRequest()
 	onlyUpParsed := reflect.New(procType.In(1).Elem()).Interface().(proto.Message)
-	err = unmarshaller.Unmarshal(onlyUpData, onlyUpParsed)
+	err = codec.unmarshaller.Unmarshal(onlyUpData, onlyUpParsed)
 	if err != nil {
 		return status.Errorf(codes.InvalidArgument, "could not parse input data to request message: %v", err)
 	}
+	err = s.validate(ctx, procedure, onlyUpParsed)
+	if err != nil {
+		return err
+	}
 	// Client streaming always starts by passing the context and nothing else to receive a stream + error
 	returnValues := caller.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(onlyUpParsed)})
 	// Parse our return values
@@ -66,7 +70,7 @@ func (s *Server) handleServerStream(ctx context.Context, procType reflect.Type,
 	res, err = wrapRecv(recv)
 	for err == nil {
 		var data []byte
-		data, err = marshaller.Marshal(res)
+		data, err = codec.marshal(res)
 		if err != nil {
 			break
 		}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Upload describes how a raw HTTP request body is streamed into a client-streaming procedure, see convert.Proxy.SetUploadProcedures
+type Upload struct {
+	// ChunkField is the bytes field of the request messages which receives each chunk of the body
+	ChunkField string
+}
+
+// SetUpload allows a client-streaming procedure to receive a raw HTTP request body, one chunk per request message.
+// The first message also has the fields set by the query string and path. Procedures which take a stream of google.api.HttpBody can receive uploads without calling SetUpload,
+// and get the request's Content-Type in the first message
+func (s *Server) SetUpload(procedure string, upload Upload) {
+	if s.uploads == nil {
+		s.uploads = map[string]Upload{}
+	}
+	s.uploads[procedure] = upload
+}
+
+func (s *Server) getUpload(procedure string) (Upload, bool) {
+	uploads := defaultServer.uploads
+	if s != nil {
+		uploads = s.uploads
+	}
+	upload, found := uploads[procedure]
+	return upload, found
+}
+
+// isUpload is true if convert is streaming a raw request body
+func isUpload(init *httpapi.RoutingInformation) bool {
+	_, found := init.GetHeaders()[convert.UploadHeader]
+	return found
+}
+
+// Raw chunks in, one struct out
+func (s *Server) handleUpload(ctx context.Context, init *httpapi.RoutingInformation, procType reflect.Type, caller reflect.Value, srv httpapi.ExposedService_ProxyStreamServer, codec codec) (err error) {
+	procedure := init.GetProcedure()
+	sendMethod, found := procType.Out(0).MethodByName("Send")
+	if !found {
+		return status.Errorf(codes.Internal, "mercury: %s has no request stream", procedure)
+	}
+	reqT := sendMethod.Type.In(sendMethod.Type.NumIn() - 1).Elem()
+	first, ok := reflect.New(reqT).Interface().(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "mercury: %s does not stream proto messages", procedure)
+	}
+	upload, found := s.getUpload(procedure)
+	if !found && !isHTTPBody(first.ProtoReflect().Descriptor()) {
+		return status.Errorf(codes.Unimplemented, "mercury: %s cannot receive uploads", procedure)
+	}
+	if !found {
+		upload.ChunkField = "data"
+	}
+	chunkField := resolveField(first.ProtoReflect().Descriptor(), []string{upload.ChunkField})
+	if chunkField == nil || chunkField.Kind() != protoreflect.BytesKind || chunkField.IsList() {
+		return status.Errorf(codes.Internal, "mercury: %s has no bytes field %s to upload into", procedure, upload.ChunkField)
+	}
+	if err = s.parseRoutedRequest(init, convert.UploadHeader, first, codec); err != nil {
+		return err
+	}
+	return s.pumpClientStream(ctx, procedure, caller, srv, codec, func(data []byte) (proto.Message, error) {
+		msg := first
+		if msg == nil {
+			msg = reflect.New(reqT).Interface().(proto.Message)
+		}
+		first = nil
+		msg.ProtoReflect().Set(chunkField, protoreflect.ValueOfBytes(data))
+		return msg, nil
+	})
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/LLKennedy/mercury/httpapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeUploadSource replays chunks as requests from convert, then io.EOF
+type fakeUploadSource struct {
+	fakeProxyStream
+	chunks []string
+}
+
+func (f *fakeUploadSource) Recv() (*httpapi.StreamedRequest, error) {
+	if len(f.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := f.chunks[0]
+	f.chunks = f.chunks[1:]
+	return &httpapi.StreamedRequest{MessageType: &httpapi.StreamedRequest_Request{Request: []byte(chunk)}}, nil
+}
+
+type uploadStream interface {
+	grpc.ClientStream
+	Send(*httpbody.HttpBody) error
+	CloseAndRecv() (*wrapperspb.Int64Value, error)
+}
+
+// fakeUploadStream records the messages sent to the procedure and replies with the total size of their data
+type fakeUploadStream struct {
+	grpc.ClientStream
+	received []*httpbody.HttpBody
+}
+
+func (f *fakeUploadStream) Send(msg *httpbody.HttpBody) error {
+	f.received = append(f.received, msg)
+	return nil
+}
+
+func (f *fakeUploadStream) SendMsg(m interface{}) error {
+	return f.Send(m.(*httpbody.HttpBody))
+}
+
+func (f *fakeUploadStream) CloseSend() error {
+	return nil
+}
+
+func (f *fakeUploadStream) CloseAndRecv() (*wrapperspb.Int64Value, error) {
+	var size int64
+	for _, msg := range f.received {
+		size += int64(len(msg.GetData()))
+	}
+	return wrapperspb.Int64(size), nil
+}
+
+func TestServer_handleUpload(t *testing.T) {
+	init := &httpapi.RoutingInformation{
+		Method:    httpapi.Method_POST,
+		Procedure: "PostArchive",
+		Headers: map[string]*httpapi.MultiVal{
+			convert.UploadHeader: {Values: []string{""}},
+			"Content-Type":       {Values: []string{"application/zip"}},
+		},
+	}
+	stream := &fakeUploadStream{}
+	upload := func(ctx context.Context) (uploadStream, error) {
+		return stream, nil
+	}
+	s := &Server{}
+	srv := &fakeUploadSource{chunks: []string{"abc", "defg"}}
+	err := s.handleUpload(context.Background(), init, reflect.TypeOf(upload), reflect.ValueOf(upload), srv, s.codecFor("PostArchive", nil))
+	assert.NoError(t, err)
+	if assert.Len(t, stream.received, 2) {
+		assert.Equal(t, "application/zip", stream.received[0].GetContentType())
+		assert.Equal(t, []byte("abc"), stream.received[0].GetData())
+		assert.Empty(t, stream.received[1].GetContentType())
+		assert.Equal(t, []byte("defg"), stream.received[1].GetData())
+	}
+	assert.Equal(t, [][]byte{[]byte(`"7"`)}, srv.sent)
+	s.SetUpload("PostArchive", Upload{ChunkField: "missing"})
+	err = s.handleUpload(context.Background(), init, reflect.TypeOf(upload), reflect.ValueOf(upload), &fakeUploadSource{}, s.codecFor("PostArchive", nil))
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -0,0 +1,173 @@
+// Package validate checks request messages against the (mercury.validate.rules) options on their fields
+package validate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/LLKennedy/mercury/convert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// patterns caches compiled patterns by their source
+var patterns sync.Map
+
+// Validate checks req against the rules on its fields and those of any nested messages, it may be passed directly to proxy.Server.SetValidator.
+// Fields marked with (google.api.field_behavior) = REQUIRED are treated as required too.
+// The returned error is convert.InvalidFields, with a google.rpc.BadRequest detail listing every violation
+func Validate(ctx context.Context, procedure string, req proto.Message) error {
+	return Message(req)
+}
+
+// Message checks msg against the rules on its fields and those of any nested messages, see Validate
+func Message(msg proto.Message) error {
+	if msg == nil {
+		return nil
+	}
+	violations := []*errdetails.BadRequest_FieldViolation{}
+	checkMessage(msg.ProtoReflect(), "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	return convert.InvalidFields(fmt.Sprintf("mercury: request has %d invalid fields", len(violations)), violations)
+}
+
+func checkMessage(msg protoreflect.Message, prefix string, violations *[]*errdetails.BadRequest_FieldViolation) {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		path := prefix + string(field.Name())
+		rules := fieldRules(field)
+		violate := func(path, format string, args ...interface{}) {
+			*violations = append(*violations, &errdetails.BadRequest_FieldViolation{
+				Field:       path,
+				Description: fmt.Sprintf(format, args...),
+			})
+		}
+		if !msg.Has(field) {
+			if rules.GetRequired() {
+				violate(path, "%s is required", path)
+			}
+			continue
+		}
+		value := msg.Get(field)
+		switch {
+		case field.IsList():
+			list := value.List()
+			checkLength(rules, uint64(list.Len()), path, "elements", violate)
+			// Length rules on repeated fields count elements, the other rules apply to each element
+			rules.MinLen, rules.MaxLen = nil, nil
+			for j := 0; j < list.Len(); j++ {
+				checkValue(field, rules, list.Get(j), fmt.Sprintf("%s[%d]", path, j), violate, violations)
+			}
+		case field.IsMap():
+			entries := value.Map()
+			checkLength(rules, uint64(entries.Len()), path, "entries", violate)
+			entries.Range(func(key protoreflect.MapKey, entry protoreflect.Value) bool {
+				checkValue(field.MapValue(), &FieldRules{}, entry, fmt.Sprintf("%s[%v]", path, key.Interface()), violate, violations)
+				return true
+			})
+		default:
+			checkValue(field, rules, value, path, violate, violations)
+		}
+	}
+}
+
+// checkValue checks a single value of field, which may be an element of a list or map, descending into messages
+func checkValue(field protoreflect.FieldDescriptor, rules *FieldRules, value protoreflect.Value, path string, violate func(path, format string, args ...interface{}), violations *[]*errdetails.BadRequest_FieldViolation) {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		checkMessage(value.Message(), path+".", violations)
+	case protoreflect.StringKind:
+		str := value.String()
+		checkLength(rules, uint64(utf8.RuneCountInString(str)), path, "characters", violate)
+		if rules.Pattern != nil {
+			pattern, err := compile(rules.GetPattern())
+			if err != nil {
+				violate(path, "%s has an invalid pattern: %v", path, err)
+			} else if !pattern.MatchString(str) {
+				violate(path, "%s must match %s", path, rules.GetPattern())
+			}
+		}
+	case protoreflect.BytesKind:
+		checkLength(rules, uint64(len(value.Bytes())), path, "bytes", violate)
+	case protoreflect.EnumKind:
+		if rules.GetDefinedOnly() && field.Enum().Values().ByNumber(value.Enum()) == nil {
+			violate(path, "%s must be a defined value of %s", path, field.Enum().FullName())
+		}
+	case protoreflect.BoolKind:
+	default:
+		var number float64
+		switch v := value.Interface().(type) {
+		case int32:
+			number = float64(v)
+		case int64:
+			number = float64(v)
+		case uint32:
+			number = float64(v)
+		case uint64:
+			number = float64(v)
+		case float32:
+			number = float64(v)
+		case float64:
+			number = v
+		}
+		if rules.Min != nil && number < rules.GetMin() {
+			violate(path, "%s must be at least %v", path, rules.GetMin())
+		}
+		if rules.Max != nil && number > rules.GetMax() {
+			violate(path, "%s must be at most %v", path, rules.GetMax())
+		}
+	}
+}
+
+func checkLength(rules *FieldRules, length uint64, path, unit string, violate func(path, format string, args ...interface{})) {
+	if rules.MinLen != nil && length < rules.GetMinLen() {
+		violate(path, "%s must have at least %d %s", path, rules.GetMinLen(), unit)
+	}
+	if rules.MaxLen != nil && length > rules.GetMaxLen() {
+		violate(path, "%s must have at most %d %s", path, rules.GetMaxLen(), unit)
+	}
+}
+
+// fieldRules returns the rules for field, which are never nil
+func fieldRules(field protoreflect.FieldDescriptor) *FieldRules {
+	rules := &FieldRules{}
+	options, ok := field.Options().(*descriptorpb.FieldOptions)
+	if !ok || options == nil {
+		return rules
+	}
+	if proto.HasExtension(options, E_Rules) {
+		if found, ok := proto.GetExtension(options, E_Rules).(*FieldRules); ok && found != nil {
+			rules = proto.Clone(found).(*FieldRules)
+		}
+	}
+	if proto.HasExtension(options, annotations.E_FieldBehavior) {
+		behaviours, _ := proto.GetExtension(options, annotations.E_FieldBehavior).([]annotations.FieldBehavior)
+		for _, behaviour := range behaviours {
+			if behaviour == annotations.FieldBehavior_REQUIRED {
+				rules.Required = proto.Bool(true)
+			}
+		}
+	}
+	return rules
+}
+
+func compile(source string) (*regexp.Regexp, error) {
+	if cached, found := patterns.Load(source); found {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(source, pattern)
+	return pattern, nil
+}
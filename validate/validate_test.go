@@ -0,0 +1,134 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/LLKennedy/mercury/convert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func ruleOptions(rules *FieldRules) *descriptorpb.FieldOptions {
+	options := &descriptorpb.FieldOptions{}
+	proto.SetExtension(options, E_Rules, rules)
+	return options
+}
+
+// testMessage builds a message type with constraints on each kind of field
+func testMessage(t *testing.T) protoreflect.MessageDescriptor {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label *descriptorpb.FieldDescriptorProto_Label, rules *FieldRules) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   kind.Enum(),
+			Label:  label,
+		}
+		if rules != nil {
+			f.Options = ruleOptions(rules)
+		}
+		return f
+	}
+	child := field("child", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, nil)
+	child.TypeName = proto.String(".test.Photo")
+	colour := field("colour", 7, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, &FieldRules{DefinedOnly: proto.Bool(true)})
+	colour.TypeName = proto.String(".test.Colour")
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/photo.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"validate.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Colour"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("COLOUR_UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("RED"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Photo"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, &FieldRules{Required: proto.Bool(true), Pattern: proto.String("^photos/[a-z]+$")}),
+				field("width", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, &FieldRules{Min: proto.Float64(1), Max: proto.Float64(4096)}),
+				field("title", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, &FieldRules{MaxLen: proto.Uint64(5)}),
+				field("tags", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated, &FieldRules{MaxLen: proto.Uint64(2)}),
+				field("scores", 5, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, repeated, &FieldRules{Max: proto.Float64(1)}),
+				child,
+				colour,
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(file, &resolver{File_validate_proto})
+	require.NoError(t, err)
+	return fd.Messages().ByName("Photo")
+}
+
+type resolver struct {
+	file protoreflect.FileDescriptor
+}
+
+func (r *resolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if path == r.file.Path() {
+		return r.file, nil
+	}
+	return nil, fmt.Errorf("%s not found", path)
+}
+
+func (r *resolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return nil, fmt.Errorf("%s not found", name)
+}
+
+func TestValidate(t *testing.T) {
+	descriptor := testMessage(t)
+	parse := func(in string) proto.Message {
+		msg := dynamicpb.NewMessage(descriptor)
+		require.NoError(t, protojson.Unmarshal([]byte(in), msg))
+		return msg
+	}
+	violations := func(err error) map[string]string {
+		errStatus, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, codes.InvalidArgument, errStatus.Code())
+		require.Len(t, errStatus.Details(), 2)
+		assert.Equal(t, convert.ReasonInvalidFields, errStatus.Details()[0].(*errdetails.ErrorInfo).GetReason())
+		found := map[string]string{}
+		for _, violation := range errStatus.Details()[1].(*errdetails.BadRequest).GetFieldViolations() {
+			found[violation.GetField()] = violation.GetDescription()
+		}
+		return found
+	}
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, Validate(context.Background(), "Photo", parse(`{"name":"photos/cat","width":10,"title":"héllo","tags":["a","b"],"scores":[0.5],"colour":"RED","child":{"name":"photos/dog"}}`)))
+	})
+	t.Run("nil", func(t *testing.T) {
+		assert.NoError(t, Message(nil))
+	})
+	t.Run("every violation", func(t *testing.T) {
+		err := Validate(context.Background(), "Photo", parse(`{"width":5000,"title":"too long","tags":["a","b","c"],"scores":[0.5,2],"colour":7,"child":{"name":"dogs/1"}}`))
+		assert.Equal(t, map[string]string{
+			"name":       "name is required",
+			"width":      "width must be at most 4096",
+			"title":      "title must have at most 5 characters",
+			"tags":       "tags must have at most 2 elements",
+			"scores[1]":  "scores[1] must be at most 1",
+			"colour":     "colour must be a defined value of test.Colour",
+			"child.name": "child.name must match ^photos/[a-z]+$",
+		}, violations(err))
+	})
+	t.Run("unset fields are only checked for required", func(t *testing.T) {
+		err := Validate(context.Background(), "Photo", parse(`{}`))
+		assert.Equal(t, map[string]string{"name": "name is required"}, violations(err))
+	})
+}